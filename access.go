@@ -0,0 +1,147 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"syscall"
+)
+
+// Credentials identifies the user on whose behalf
+// an access check is performed.
+type Credentials struct {
+	UID    UID   // effective user ID
+	GID    GID   // effective group ID
+	Groups []GID // supplementary group IDs
+}
+
+// CurrentCredentials returns the credentials
+// of the current process.
+func CurrentCredentials() (Credentials, error) {
+	groups, err := os.Getgroups()
+	if err != nil {
+		return Credentials{}, err
+	}
+	cred := Credentials{UID: UID(os.Geteuid()), GID: GID(os.Getegid())}
+	for _, g := range groups {
+		cred.Groups = append(cred.Groups, GID(g))
+	}
+	return cred, nil
+}
+
+func (c Credentials) inGroup(gid GID) bool {
+	if c.GID == gid {
+		return true
+	}
+	for _, g := range c.Groups {
+		if g == gid {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckAccess returns whether a user with the credentials
+// cred is granted all of the permissions in perms (a
+// combination of 4 for read, 2 for write, and 1 for execute)
+// by a, which is the ACL of a file owned by the user owner
+// and the group group. It implements the POSIX.1e access
+// check algorithm:
+//  - if cred.UID is the owner, the TagUserObj entry is used
+//  - otherwise, if there is a TagUser entry for cred.UID,
+//    it is used, limited by the mask
+//  - otherwise, if cred matches the owning group (the
+//    TagGroupObj entry) or any TagGroup entries, access is
+//    granted if any of those entries grants all of perms
+//    (limited by the mask), and denied otherwise
+//  - otherwise, the TagOther entry is used
+// Privileges which override permission checks (such as
+// those of root on Linux) are not taken into account.
+// If a is not valid as defined by a.IsValid, the behavior
+// of CheckAccess is undefined.
+func (a ACL) CheckAccess(owner UID, group GID, cred Credentials, perms os.FileMode) bool {
+	want := perms & 7
+	mask := os.FileMode(7)
+	for _, e := range a {
+		if e.Tag == TagMask {
+			mask = e.perms()
+		}
+	}
+	granted := func(e Entry, mask os.FileMode) bool {
+		return e.perms()&mask&want == want
+	}
+
+	if cred.UID == owner {
+		for _, e := range a {
+			if e.Tag == TagUserObj {
+				return granted(e, 7)
+			}
+		}
+		return false
+	}
+	for _, e := range a {
+		if uid, ok := e.UID(); ok && uid == cred.UID {
+			return granted(e, mask)
+		}
+	}
+
+	var matched bool
+	for _, e := range a {
+		var match bool
+		switch e.Tag {
+		case TagGroupObj:
+			match = cred.inGroup(group)
+		case TagGroup:
+			gid, ok := e.GID()
+			match = ok && cred.inGroup(gid)
+		}
+		if match {
+			if granted(e, mask) {
+				return true
+			}
+			matched = true
+		}
+	}
+	if matched {
+		return false
+	}
+
+	for _, e := range a {
+		if e.Tag == TagOther {
+			return granted(e, 7)
+		}
+	}
+	return false
+}
+
+// CheckAccess returns whether a user with the credentials
+// cred is granted all of the permissions in perms by the
+// access ACL of path, as determined by ACL.CheckAccess
+// using the owner and group of path. If path is a
+// symbolic link, it is followed.
+func CheckAccess(path string, cred Credentials, perms os.FileMode) (bool, error) {
+	return FS{Backend: OSBackend}.CheckAccess(path, cred, perms)
+}
+
+// CheckAccess returns whether a user with the credentials
+// cred is granted the permissions in perms by the access
+// ACL of path like the package-level CheckAccess.
+func (fs FS) CheckAccess(path string, cred Credentials, perms os.FileMode) (bool, error) {
+	fi, err := fs.Backend.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	uid, gid, ok := fileOwner(fi)
+	if !ok {
+		return false, pathError("access", path, syscall.ENOTSUP)
+	}
+	acl, err := fs.Get(path)
+	if err != nil {
+		return false, err
+	}
+	return acl.CheckAccess(UID(uid), GID(gid), cred, perms), nil
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestCheckAccess(t *testing.T) {
+	// owner 100, owning group 200
+	acl := ACL{
+		{TagUserObj, "", 6},
+		{TagUser, "101", 7},
+		{TagUser, "102", 0},
+		{TagGroupObj, "", 4},
+		{TagGroup, "201", 2},
+		{TagGroup, "202", 1},
+		{TagMask, "", 6},
+		{TagOther, "", 5},
+	}
+	cases := []struct {
+		Cred  Credentials
+		Perms os.FileMode
+		Want  bool
+	}{
+		{Credentials{UID: 100, GID: 300}, 6, true},                          // owner
+		{Credentials{UID: 100, GID: 300}, 1, false},                         // owner does not fall through to other
+		{Credentials{UID: 101, GID: 300}, 6, true},                          // named user
+		{Credentials{UID: 101, GID: 300}, 1, false},                         // named user limited by mask
+		{Credentials{UID: 102, GID: 300}, 4, false},                         // named user does not fall through to other
+		{Credentials{UID: 103, GID: 200}, 4, true},                          // owning group
+		{Credentials{UID: 103, GID: 200}, 1, false},                         // matching group does not fall through to other
+		{Credentials{UID: 103, GID: 300, Groups: []GID{201}}, 2, true},      // supplementary named group
+		{Credentials{UID: 103, GID: 300, Groups: []GID{200, 201}}, 2, true}, // any matching group
+		{Credentials{UID: 103, GID: 300, Groups: []GID{200, 201}}, 6, false},
+		{Credentials{UID: 103, GID: 202}, 1, false}, // named group limited by mask
+		{Credentials{UID: 103, GID: 300}, 5, true},  // other
+		{Credentials{UID: 103, GID: 300}, 2, false},
+	}
+	for i, c := range cases {
+		if got := acl.CheckAccess(100, 200, c.Cred, c.Perms); got != c.Want {
+			t.Errorf("case %v: unexpected result: want %v; got %v", i, c.Want, got)
+		}
+	}
+}
+
+func TestCheckAccessPath(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+	testutil.Must(t, Set(f, ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 0}, {TagOther, "", 0}}))
+	cred, err := CurrentCredentials()
+	testutil.Must(t, err)
+	ok, err := CheckAccess(f, cred, 6)
+	testutil.Must(t, err)
+	if !ok {
+		t.Errorf("owner denied read and write access")
+	}
+	ok, err = CheckAccess(f, cred, 1)
+	testutil.Must(t, err)
+	if ok {
+		t.Errorf("owner granted execute access")
+	}
+}
@@ -9,12 +9,18 @@
 // See the acl manpage for details: http://linux.die.net/man/5/acl
 //
 // Currently, only Linux is supported. On systems which
-// are not supported, all calls will return the error
-// syscall.ENOTSUP.
+// are not supported, all calls will return an error
+// matching ErrNotSupported.
+//
+// Errors from file operations are *os.PathErrors which
+// identify the operation and path. Where applicable, the
+// underlying error matches one of the sentinel errors
+// ErrNotSupported, ErrNotDirectory, ErrMalformedXattr, and
+// ErrSymlink when compared using errors.Is, as well as the
+// original system error (such as syscall.ENOTSUP).
 package acl
 
 import (
-	"errors"
 	"fmt"
 	"os"
 	"strings"
@@ -39,9 +45,11 @@ func FromUnix(perms os.FileMode) ACL {
 }
 
 // ToUnix returns the unix permissions bitmask
-// encoded by a. If a is not valid as defined
-// by a.IsValid, the behavior of ToUnix is
-// undefined.
+// encoded by a. The group permissions are taken
+// from the TagGroupObj entry, even if a has a mask
+// entry; see ToMode for the permissions reported by
+// stat. If a is not valid as defined by a.IsValid,
+// the behavior of ToUnix is undefined.
 func ToUnix(a ACL) os.FileMode {
 	var perms os.FileMode
 	for _, e := range a {
@@ -57,6 +65,47 @@ func ToUnix(a ACL) os.FileMode {
 	return perms
 }
 
+// ToMode returns the permission bits of a file whose
+// access ACL is a, as reported by stat and shown by
+// ls -l. If a has a mask entry, the group permissions
+// are those of the mask entry; otherwise, they are
+// those of the TagGroupObj entry. If a is not valid as
+// defined by a.IsValid, the behavior of ToMode is
+// undefined.
+func ToMode(a ACL) os.FileMode {
+	perms := ToUnix(a)
+	if mask, ok := a.Mask(); ok {
+		perms = perms&^070 | mask<<3
+	}
+	return perms
+}
+
+// Chmod returns a copy of a whose permissions have been
+// changed to the permission bits of mode, as the Linux
+// kernel does when the mode of a file with the access
+// ACL a is changed: the owner and other permissions
+// replace those of the TagUserObj and TagOther entries,
+// and the group permissions replace those of the mask
+// entry if there is one, and those of the TagGroupObj
+// entry otherwise. Named entries are unchanged. All
+// non-permission bits in mode are ignored.
+func (a ACL) Chmod(mode os.FileMode) ACL {
+	_, hasMask := a.Mask()
+	newACL := make(ACL, len(a))
+	for i, e := range a {
+		switch {
+		case e.Tag == TagUserObj:
+			e.Perms = (mode >> 6) & 7
+		case e.Tag == TagMask, e.Tag == TagGroupObj && !hasMask:
+			e.Perms = (mode >> 3) & 7
+		case e.Tag == TagOther:
+			e.Perms = mode & 7
+		}
+		newACL[i] = e
+	}
+	return newACL
+}
+
 // IsValid returns whether a is a valid ACL as defined
 // by the POSIX.1e draft standard.
 //
@@ -67,50 +116,10 @@ func ToUnix(a ACL) os.FileMode {
 //  - if it contains any entries with the tag TagUser or TagGroup, it must contain exactly one
 //    entry with the tag TagMask; otherwise, such an entry is optional (there can be zero or one)
 //  - all qualifiers must be unique among entries of the same tag type (TagUser or TagGroup)
+//
+// To find out why an ACL is invalid, use Validate.
 func (a ACL) IsValid() bool {
-	var numUserObj, numGroupObj, numOther int
-	var numMask, numUserOrGroup int
-	users := make(map[string]bool)
-	groups := make(map[string]bool)
-	for _, e := range a {
-		switch e.Tag {
-		case TagUserObj:
-			numUserObj++
-		case TagGroupObj:
-			numGroupObj++
-		case TagOther:
-			numOther++
-		case TagMask:
-			numMask++
-		case TagUser:
-			numUserOrGroup++
-			if users[e.Qualifier] {
-				return false
-			}
-			users[e.Qualifier] = true
-		case TagGroup:
-			numUserOrGroup++
-			if groups[e.Qualifier] {
-				return false
-			}
-			groups[e.Qualifier] = true
-		default:
-			return false
-		}
-	}
-	switch {
-	case numUserObj != 1:
-		return false
-	case numGroupObj != 1:
-		return false
-	case numOther != 1:
-		return false
-	case numUserOrGroup > 0 && numMask == 0:
-		return false
-	case numMask > 1:
-		return false
-	}
-	return true
+	return a.Validate() == nil
 }
 
 // String implements the POSIX.1e short text form.
@@ -121,9 +130,15 @@ func (a ACL) IsValid() bool {
 // execute; other has no permissions; the user dvader has
 // read; and the mask is read.
 func (a ACL) String() string {
+	return a.StringWith(defaultResolver)
+}
+
+// StringWith is like String, but uses r to
+// look up the names of users and groups.
+func (a ACL) StringWith(r Resolver) string {
 	strs := make([]string, len(a))
 	for i, e := range a {
-		strs[i] = e.String()
+		strs[i] = e.StringWith(r)
 	}
 	return strings.Join(strs, ",")
 }
@@ -136,24 +151,64 @@ func (a ACL) String() string {
 //  user:dvader:r--
 //  mask::r--
 func (a ACL) StringLong() string {
+	return a.StringLongWith(defaultResolver)
+}
+
+// StringLongWith is like StringLong, but uses r
+// to look up the names of users and groups.
+func (a ACL) StringLongWith(r Resolver) string {
 	lines := make([]string, len(a))
-	mask := os.FileMode(7)
+	effective := a.EffectivePerms()
+	for i, e := range a {
+		if effective[i] != e.perms() {
+			lines[i] = fmt.Sprintf("%-20s#effective:%s", e.StringLongWith(r), permString(effective[i]))
+		} else {
+			lines[i] = e.StringLongWith(r)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Mask returns the permissions of the entry in a with
+// the tag TagMask. If there is no such entry, ok is false.
+func (a ACL) Mask() (mask os.FileMode, ok bool) {
 	for _, e := range a {
 		if e.Tag == TagMask {
-			mask = e.perms()
-			break
+			return e.perms(), true
 		}
 	}
+	return 0, false
+}
+
+// EffectivePerms returns the effective permissions of
+// each entry in a, in the same order as the entries.
+// The permissions of entries with the tags TagUser,
+// TagGroupObj, and TagGroup are limited by the mask
+// entry, if any; other entries are unaffected.
+func (a ACL) EffectivePerms() []os.FileMode {
+	mask, ok := a.Mask()
+	if !ok {
+		mask = 7
+	}
+	perms := make([]os.FileMode, len(a))
 	for i, e := range a {
-		if (e.Tag == TagUser || e.Tag == TagGroupObj || e.Tag == TagGroup) &&
-			mask|e.perms() != mask {
-			effective := mask & e.perms()
-			lines[i] = fmt.Sprintf("%-20s#effective:%s", e.StringLong(), permString(effective))
-		} else {
-			lines[i] = e.StringLong()
+		perms[i] = e.EffectivePerms(mask)
+	}
+	return perms
+}
+
+// ReducedByMask returns the entries of a which are
+// granted permissions that do not take effect because
+// they are not also granted by the mask entry. Tools
+// can use it to warn users whose changes have no effect.
+func (a ACL) ReducedByMask() []Entry {
+	var reduced []Entry
+	for i, perms := range a.EffectivePerms() {
+		if perms != a[i].perms() {
+			reduced = append(reduced, a[i])
 		}
 	}
-	return strings.Join(lines, "\n")
+	return reduced
 }
 
 // Tag is the type of an ACL entry tag.
@@ -209,35 +264,44 @@ func (t Tag) StringLong() string {
 type Entry struct {
 	Tag Tag
 
-	// TODO(joshlf): it would be nice if we could handle
-	// the UID/user name or GID/group name transition
-	// transparently under the hood rather than pushing
-	// the responsibility to the user. However, there are
-	// some subtle considerations:
-	//   - It must be valid to provide a UID/GID for a
-	//     user or group that does not exist (setfactl
-	//     supports this)
-	//   - If the qualifier can be either a UID/GID or
-	//     a user name/group name, there should probably
-	//     be a better way of encoding it (that is,
-	//     better than just setting it to one or the
-	//     other and letting the user implement custom
-	//     logic to tell the difference)
-
 	// The Qualifier specifies what entity (user or group)
 	// this entry applies to. If the Tag is TagUser, it is
 	// a UID; if the Tag is TagGroup, it is a GID; otherwise
-	// the field is ignored. Note that the qualifier must
-	// be a UID or GID - it cannot be, for example, a user name.
+	// the field is ignored. UIDs and GIDs are stored in
+	// decimal. The Qualifier may also temporarily hold a
+	// user or group name, but such an entry must be resolved
+	// (see the Resolve method) before it can be stored in
+	// a file's ACL.
+	//
+	// New code should prefer constructing entries with
+	// UserEntry and GroupEntry and inspecting them with the
+	// UID, GID, and Qual methods, which do not require
+	// formatting or parsing the qualifier by hand.
 	Qualifier string
 
 	// ACL permissions are taken from a traditional rwx
 	// (read/write/execute) permissions vector. The Perms
-	// field stores these as the lowest three bits -
-	// the bits in any higher positions are ignored.
+	// field stores these as the lowest three bits - the
+	// bits in any higher positions are ignored, except
+	// for the ConditionalExecute bit where it is enabled
+	// (see ConditionalExecute).
 	Perms os.FileMode
 }
 
+// EffectivePerms returns the permissions of e limited
+// by the permissions of the mask entry, mask, if e is
+// affected by the mask (that is, if its tag is TagUser,
+// TagGroupObj, or TagGroup). Otherwise, it returns the
+// permissions of e unchanged.
+func (e Entry) EffectivePerms(mask os.FileMode) os.FileMode {
+	switch e.Tag {
+	case TagUser, TagGroupObj, TagGroup:
+		return e.perms() & mask
+	default:
+		return e.perms()
+	}
+}
+
 // Use e.perms() to make sure that only
 // the lowest three bits are set - some
 // algorithms may inadvertently break
@@ -262,25 +326,38 @@ func permString(perm os.FileMode) string {
 
 // String implements the POSIX.1e short text form.
 func (e Entry) String() string {
-	middle := "::"
-	if e.Tag == TagUser || e.Tag == TagGroup {
-		middle = ":" + formatQualifier(e.Qualifier, e.Tag) + ":"
-	}
-	return fmt.Sprintf("%s%s%s", e.Tag, middle, permString(e.perms()))
+	return e.StringWith(defaultResolver)
+}
+
+// StringWith is like String, but uses r to
+// look up the name of the user or group.
+func (e Entry) StringWith(r Resolver) string {
+	return e.format(e.Tag.String(), r)
 }
 
 // StringLong implements the POSIX.1e long text form.
 func (e Entry) StringLong() string {
+	return e.StringLongWith(defaultResolver)
+}
+
+// StringLongWith is like StringLong, but uses r
+// to look up the name of the user or group.
+func (e Entry) StringLongWith(r Resolver) string {
+	return e.format(e.Tag.StringLong(), r)
+}
+
+func (e Entry) format(tag string, r Resolver) string {
 	middle := "::"
 	if e.Tag == TagUser || e.Tag == TagGroup {
-		middle = ":" + formatQualifier(e.Qualifier, e.Tag) + ":"
+		middle = ":" + quote(formatQualifier(r, e.Qualifier, e.Tag), quoteEntry) + ":"
 	}
-	return fmt.Sprintf("%s%s%s", e.Tag.StringLong(), middle, permString(e.perms()))
+	perms := permString(e.perms())
+	if e.Perms&ConditionalExecute != 0 && e.perms()&1 == 0 {
+		perms = perms[:2] + "X"
+	}
+	return fmt.Sprintf("%s%s%s", tag, middle, perms)
 }
 
-// overwrite in other files to implement platform-specific behavior
-var formatQualifier = func(q string, tag Tag) string { return q }
-
 // Get retrieves the access ACL associated with path,
 // returning any error encountered.
 func Get(path string) (ACL, error) {
@@ -308,8 +385,8 @@ func FGetDefault(f *os.File) (ACL, error) {
 // Set sets the access ACL on path,
 // returning any error encountered.
 func Set(path string, acl ACL) error {
-	if !acl.IsValid() {
-		return fmt.Errorf("invalid ACL")
+	if err := acl.Validate(); err != nil {
+		return pathError("set", path, err)
 	}
 	return set(path, acl)
 }
@@ -317,8 +394,8 @@ func Set(path string, acl ACL) error {
 // FSet sets the access ACL on an *os.File,
 // returning any error encountered.
 func FSet(f *os.File, acl ACL) error {
-	if !acl.IsValid() {
-		return fmt.Errorf("invalid ACL")
+	if err := acl.Validate(); err != nil {
+		return pathError("set", f.Name(), err)
 	}
 	return fset(f, acl)
 }
@@ -326,8 +403,8 @@ func FSet(f *os.File, acl ACL) error {
 // SetDefault sets the default ACL on path,
 // returning any error encountered.
 func SetDefault(path string, acl ACL) error {
-	if !acl.IsValid() {
-		return fmt.Errorf("invalid ACL")
+	if err := acl.Validate(); err != nil {
+		return pathError("setdefault", path, err)
 	}
 	return setDefault(path, acl)
 }
@@ -335,22 +412,217 @@ func SetDefault(path string, acl ACL) error {
 // FSetDefault sets the default ACL on an *os.File,
 // returning any error encountered.
 func FSetDefault(f *os.File, acl ACL) error {
-	if !acl.IsValid() {
-		return fmt.Errorf("invalid ACL")
+	if err := acl.Validate(); err != nil {
+		return pathError("setdefault", f.Name(), err)
 	}
 	return fsetDefault(f, acl)
 }
 
-func add(oldACL ACL, entries ...Entry) (newACL ACL, err error) {
-	var (
-		addUserGroup bool // entries contains TagUser or TagGroup element
-		addMask      bool // entries contains TagMask element
-	)
+// LGet retrieves the access ACL associated with path like
+// Get, but doesn't follow a symbolic link in the final
+// component of path. Since Linux doesn't support ACLs on
+// symbolic links, an error matching ErrSymlink is returned
+// if path is a symbolic link. Use LGet and the other L
+// functions instead of Get and Set when an untrusted user
+// can replace files with symbolic links, which would
+// otherwise redirect the operation to another file.
+func LGet(path string) (ACL, error) {
+	return lget(path)
+}
+
+// LGetDefault retrieves the default ACL associated
+// with path like GetDefault, but doesn't follow a
+// symbolic link in the final component of path.
+func LGetDefault(path string) (ACL, error) {
+	return lgetDefault(path)
+}
+
+// LSet sets the access ACL on path like Set, but doesn't
+// follow a symbolic link in the final component of path.
+// If path is a symbolic link, an error matching ErrSymlink
+// is returned.
+func LSet(path string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return pathError("set", path, err)
+	}
+	return lset(path, acl)
+}
+
+// LSetDefault sets the default ACL on path like
+// SetDefault, but doesn't follow a symbolic link
+// in the final component of path.
+func LSetDefault(path string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return pathError("setdefault", path, err)
+	}
+	return lsetDefault(path, acl)
+}
+
+// Options configures how the ACL modification functions
+// which are methods on it compute the new ACL. The zero
+// value gives the default behavior of setfacl, which is
+// also that of the package-level Remove functions.
+type Options struct {
+	// If NoMaskRecalc is true, the permissions of an
+	// existing mask entry are left unchanged rather than
+	// being recalculated (like setfacl -n). A mask entry
+	// is still added if one is required for the new ACL
+	// to be valid.
+	NoMaskRecalc bool
+
+	// Resolver is used to resolve user and group names in
+	// the qualifiers of keys passed to Remove and the other
+	// removal methods. If it is nil, the system's user and
+	// group database is used.
+	Resolver Resolver
+
+	// If ConditionalExecute is true, the ConditionalExecute
+	// bit in the entries passed to Set, Add, and the other
+	// methods which modify ACLs is resolved for each file.
+	// Otherwise, it is ignored like any other bit above the
+	// lowest three.
+	ConditionalExecute bool
+}
+
+// Set sets the access ACL on path like the package-level
+// Set. If acl has no mask entry and o.NoMaskRecalc is
+// false, a mask entry is first added as by
+// ACL.RecalculateMask if one is required (like
+// setfacl --set).
+func (o Options) Set(path string, acl ACL) error {
+	acl, err := o.resolve(acl, func() (os.FileInfo, error) { return os.Stat(path) })
+	if err != nil {
+		return err
+	}
+	return Set(path, o.withMask(acl))
+}
+
+// FSet sets the access ACL like Options.Set,
+// but on an *os.File.
+func (o Options) FSet(f *os.File, acl ACL) error {
+	acl, err := o.resolve(acl, f.Stat)
+	if err != nil {
+		return err
+	}
+	return FSet(f, o.withMask(acl))
+}
+
+// SetDefault sets the default ACL on path like
+// Options.Set.
+func (o Options) SetDefault(path string, acl ACL) error {
+	acl, err := o.resolve(acl, func() (os.FileInfo, error) { return os.Stat(path) })
+	if err != nil {
+		return err
+	}
+	return SetDefault(path, o.withMask(acl))
+}
+
+// FSetDefault sets the default ACL like
+// Options.SetDefault, but on an *os.File.
+func (o Options) FSetDefault(f *os.File, acl ACL) error {
+	acl, err := o.resolve(acl, f.Stat)
+	if err != nil {
+		return err
+	}
+	return FSetDefault(f, o.withMask(acl))
+}
+
+// resolve resolves the ConditionalExecute bit in the
+// entries of acl if o.ConditionalExecute is true.
+func (o Options) resolve(acl ACL, stat func() (os.FileInfo, error)) (ACL, error) {
+	if !o.ConditionalExecute {
+		return acl, nil
+	}
+	return resolveCondExecute(acl, stat)
+}
+
+func (o Options) withMask(acl ACL) ACL {
+	if _, ok := acl.Mask(); ok || o.NoMaskRecalc {
+		return acl
+	}
+	return acl.RecalculateMask()
+}
+
+// Chmod changes the permissions of the access ACL on
+// path as described by ACL.Chmod, so that the permission
+// bits of the file become those of mode. Unlike os.Chmod,
+// the setuid, setgid, and sticky bits are left unchanged.
+func Chmod(path string, mode os.FileMode) error {
+	acl, err := get(path)
+	if err != nil {
+		return err
+	}
+	return set(path, acl.Chmod(mode))
+}
+
+// FChmod changes the permissions of the access
+// ACL like Chmod, but on an *os.File.
+func FChmod(f *os.File, mode os.FileMode) error {
+	acl, err := fget(f)
+	if err != nil {
+		return err
+	}
+	return fset(f, acl.Chmod(mode))
+}
+
+// ConditionalExecute is a permission bit which may be set in
+// the Perms field of entries in addition to the rwx bits.
+// Like setfacl's X permission, it grants execute permission
+// only if the file the entry is applied to is a directory or
+// already has execute permission for some user. It is never
+// stored in a file's ACL.
+//
+// Since the bits above the lowest three of Perms are otherwise
+// ignored, ConditionalExecute is only resolved where it is
+// explicitly enabled: by the methods of Options and FS when
+// Options.ConditionalExecute is true, and by AddRecursive and
+// SetRecursive, which resolve it against each file in the
+// tree. Elsewhere, as in the package-level Set and Add, it is
+// ignored, so that permissions taken from an unmasked file
+// mode (such as fi.Mode()>>3) never grant execute permission.
+//
+// In the text forms, ConditionalExecute is written as X.
+const ConditionalExecute os.FileMode = 010
+
+// resolveCondExecute resolves the ConditionalExecute bit in the
+// entries of a using condExecute. stat is used to retrieve
+// information about the file, and is only called if necessary.
+func resolveCondExecute(a ACL, stat func() (os.FileInfo, error)) (ACL, error) {
+	for _, e := range a {
+		if e.Perms&ConditionalExecute != 0 {
+			fi, err := stat()
+			if err != nil {
+				return nil, err
+			}
+			return condExecute(a, fi), nil
+		}
+	}
+	return a, nil
+}
+
+// condExecute returns a copy of a in which the ConditionalExecute
+// bit in each entry has been replaced by the execute bit if fi
+// describes a directory or a file that is executable by anyone,
+// and removed otherwise.
+func condExecute(a ACL, fi os.FileInfo) ACL {
+	exec := fi.IsDir() || fi.Mode()&0111 != 0
+	resolved := make(ACL, len(a))
+	for i, e := range a {
+		if e.Perms&ConditionalExecute != 0 {
+			e.Perms &^= ConditionalExecute
+			if exec {
+				e.Perms |= 1
+			}
+		}
+		resolved[i] = e
+	}
+	return resolved
+}
+
+func add(oldACL ACL, recalc bool, entries ...Entry) (newACL ACL, err error) {
+	var addMask bool // entries contains TagMask element
 	for _, e := range entries {
-		switch e.Tag {
-		case TagUser, TagGroup:
-			addUserGroup = true
-		case TagMask:
+		if e.Tag == TagMask {
 			addMask = true
 		}
 	}
@@ -358,60 +630,74 @@ func add(oldACL ACL, entries ...Entry) (newACL ACL, err error) {
 	// put all of the entries into a map: first the
 	// old entries, and then the new ones (so that
 	// new entries overwrite old entries)
-	type key struct {
-		Tag       Tag
-		Qualifier string
-	}
-	m := make(map[key]Entry)
+	m := make(map[Key]Entry)
 	for _, e := range oldACL {
-		// we can rely on e.Qualifier to be the
-		// empty string if e.Tag is neither TagUser
-		// nor TagGroup (see the implementation of
-		// get in acl_impl.go)
-		m[key{e.Tag, e.Qualifier}] = e
+		m[e.Key()] = e
 	}
 	for _, e := range entries {
-		// the user could have passed an entry
-		// whose Qualifier field was spuriously
-		// non-empty; clean their input in case
-		// this happened
-		tag := e.Tag
-		qual := e.Qualifier
-		if tag != TagUser && tag != TagGroup {
-			qual = ""
-		}
-		m[key{tag, qual}] = e
-	}
-
-	if addUserGroup && !addMask {
-		// automatically add mask entry;
-		// calculate its permissions to
-		// be the union of all TagUser and
-		// TagGroup permissions (see the
-		// doc comment on this function)
-		var mperms os.FileMode
-		for _, e := range m {
-			switch e.Tag {
-			case TagUser, TagGroup, TagGroupObj:
-				mperms |= e.Perms
-			}
-		}
-		m[key{Tag: TagMask}] = Entry{Tag: TagMask, Perms: mperms}
+		m[e.Key()] = e
 	}
 
 	for _, e := range m {
 		newACL = append(newACL, e)
 	}
-	if !newACL.IsValid() {
-		return newACL, errors.New("add results in invalid ACL")
+	if _, hasMask := newACL.Mask(); !addMask && (recalc || !hasMask) {
+		// recalculate the mask unless it was supplied
+		// explicitly; even if recalculation is disabled,
+		// a mask must be added if there are now named
+		// entries (see the doc comment on Add)
+		newACL = newACL.RecalculateMask()
+	}
+	if err := newACL.Validate(); err != nil {
+		return newACL, err
 	}
 	return
 }
 
-// TODO(joshlf): It seems as though the mask also
-// affects entries with the tag TagGroupObj, so
-// when calculating the new mask, its bits should
-// be taken into account as well.
+// RecalculateMask returns a copy of a in which the
+// permissions of the mask entry are the union of the
+// permissions of all entries affected by the mask
+// (namely, all entries with the tags TagUser, TagGroup,
+// and TagGroupObj), as setfacl does by default after
+// modifying an ACL. If a has named user or group
+// entries but no mask entry, a mask entry is added.
+// If a has neither, the copy is unchanged.
+func (a ACL) RecalculateMask() ACL {
+	newACL := append(ACL(nil), a...)
+	for _, e := range a {
+		switch e.Tag {
+		case TagUser, TagGroup, TagMask:
+			return newACL.withMask(maskPerms(newACL))
+		}
+	}
+	return newACL
+}
+
+// maskPerms returns the union of the permissions of
+// all entries in a which are affected by the mask.
+func maskPerms(a ACL) os.FileMode {
+	var mperms os.FileMode
+	for _, e := range a {
+		switch e.Tag {
+		case TagUser, TagGroup, TagGroupObj:
+			mperms |= e.perms()
+		}
+	}
+	return mperms
+}
+
+// withMask returns a with the permissions of its mask
+// entry set to perms, adding a mask entry if necessary.
+// a is modified in place if it has a mask entry.
+func (a ACL) withMask(perms os.FileMode) ACL {
+	for i := range a {
+		if a[i].Tag == TagMask {
+			a[i].Perms = perms
+			return a
+		}
+	}
+	return append(a, Entry{Tag: TagMask, Perms: perms})
+}
 
 // Add adds the given entries to the ACL on path.
 // Any matching entries that exist on the file
@@ -419,36 +705,296 @@ func add(oldACL ACL, entries ...Entry) (newACL ACL, err error) {
 // have the same tag (and, if that tag is TagUser
 // or TagGroup, they also have the same qualifier).
 //
-// In order to ensure that the new ACL is valid,
-// after being calculated from the old ACL and the
-// new entries, the new ACL is modified as follows:
-// If the ACL includes named user or group entries
+// If entries includes named user or group entries
 // (with the tags TagUser or TagGroup) but no mask
-// entry, a mask entry is added. This entry's
-// permissions are the union of all permissions
-// affected by the entry (namely, all entries with
-// the tags TagUser, TagGroup, or TagGroupObj).
+// entry, the mask entry of the new ACL is recalculated
+// as by ACL.RecalculateMask, and added if the ACL had
+// none. Otherwise, an existing mask entry is left
+// unchanged. To recalculate the mask after every
+// modification, as setfacl does, use Options.Add.
 func Add(path string, entries ...Entry) error {
+	return addOptions(entries).Add(path, entries...)
+}
+
+// FAdd adds the given entries to the ACL like Add, but on an *os.File
+func FAdd(f *os.File, entries ...Entry) error {
+	return addOptions(entries).FAdd(f, entries...)
+}
+
+// addOptions returns the Options which give the behavior
+// of the package-level Add for entries: the mask is only
+// recalculated if entries includes named entries.
+func addOptions(entries []Entry) Options {
+	for _, e := range entries {
+		if e.Tag == TagUser || e.Tag == TagGroup {
+			return Options{}
+		}
+	}
+	return Options{NoMaskRecalc: true}
+}
+
+// Add adds the given entries to the ACL on path like
+// the package-level Add. Unless entries includes a mask
+// entry, the mask entry of the new ACL is recalculated
+// after every modification (like setfacl -m), or only
+// added if it is required and missing if o.NoMaskRecalc
+// is true.
+func (o Options) Add(path string, entries ...Entry) error {
 	oldACL, err := get(path)
 	if err != nil {
 		return err
 	}
-	newACL, err := add(oldACL, entries...)
+	resolved, err := o.resolve(entries, func() (os.FileInfo, error) { return os.Stat(path) })
 	if err != nil {
 		return err
 	}
+	newACL, err := add(oldACL, !o.NoMaskRecalc, resolved...)
+	if err != nil {
+		return pathError("add", path, err)
+	}
 	return set(path, newACL)
 }
 
-// FAdd adds the given entries to the ACL like Add, but on an *os.File
-func FAdd(f *os.File, entries ...Entry) error {
+// FAdd adds the given entries to the ACL like
+// Options.Add, but on an *os.File.
+func (o Options) FAdd(f *os.File, entries ...Entry) error {
 	oldACL, err := fget(f)
 	if err != nil {
 		return err
 	}
-	newACL, err := add(oldACL, entries...)
+	resolved, err := o.resolve(entries, f.Stat)
 	if err != nil {
 		return err
 	}
+	newACL, err := add(oldACL, !o.NoMaskRecalc, resolved...)
+	if err != nil {
+		return pathError("add", f.Name(), err)
+	}
 	return fset(f, newACL)
 }
+
+// Key identifies an entry in an ACL. Two entries match
+// if they have the same tag and, if that tag is TagUser
+// or TagGroup, the same qualifier.
+type Key struct {
+	Tag       Tag
+	Qualifier string
+}
+
+// Key returns the key identifying e. The qualifier is
+// cleared if the tag of e is neither TagUser nor TagGroup.
+func (e Entry) Key() Key {
+	// the user could have passed an entry
+	// whose Qualifier field was spuriously
+	// non-empty; clean their input in case
+	// this happened
+	if e.Tag != TagUser && e.Tag != TagGroup {
+		return Key{Tag: e.Tag}
+	}
+	return Key{e.Tag, e.Qualifier}
+}
+
+func remove(oldACL ACL, recalc bool, r Resolver, keys ...Key) (newACL ACL, err error) {
+	if r == nil {
+		r = defaultResolver
+	}
+	rm := make(map[Key]bool)
+	for _, k := range keys {
+		switch k.Tag {
+		case TagUserObj, TagGroupObj, TagOther:
+			return nil, fmt.Errorf("cannot remove required entry with tag %s", k.Tag.StringLong())
+		case TagUser, TagGroup:
+			// entries in a file's ACL always have
+			// numeric qualifiers, so resolve names
+			q, err := ParseQualifier(k.Qualifier).ResolveWith(k.Tag, r)
+			if err != nil {
+				return nil, err
+			}
+			k.Qualifier = q.String()
+		default:
+			k.Qualifier = ""
+		}
+		rm[k] = true
+	}
+
+	for _, e := range oldACL {
+		if !rm[e.Key()] {
+			newACL = append(newACL, e)
+		}
+	}
+	if recalc && !rm[Key{Tag: TagMask}] {
+		newACL = newACL.RecalculateMask()
+	}
+	if err := newACL.Validate(); err != nil {
+		return newACL, err
+	}
+	return newACL, nil
+}
+
+// Remove removes the entries matching the given keys
+// from the access ACL on path (like setfacl -x). Keys
+// which don't match any entry are ignored. The qualifiers
+// of keys may be user or group names, which are resolved
+// to UIDs and GIDs using the system's user and group
+// database (see RemoveWith). The entries with the tags TagUserObj,
+// TagGroupObj, and TagOther are required and can't be
+// removed; the mask entry can only be removed once all
+// named user and group entries have been removed.
+//
+// If the resulting ACL has a mask entry, its permissions
+// are recalculated as by ACL.RecalculateMask. To leave the
+// mask entry unchanged, use Options.Remove with NoMaskRecalc.
+func Remove(path string, keys ...Key) error {
+	return Options{}.Remove(path, keys...)
+}
+
+// RemoveWith removes entries from the access ACL on path
+// like Remove, but uses r to resolve user and group names
+// in the qualifiers of keys.
+func RemoveWith(path string, r Resolver, keys ...Key) error {
+	return Options{Resolver: r}.Remove(path, keys...)
+}
+
+// FRemove removes entries from the ACL like Remove, but on an *os.File.
+func FRemove(f *os.File, keys ...Key) error {
+	return Options{}.FRemove(f, keys...)
+}
+
+// RemoveFromDefault removes entries from the default ACL
+// on path like Remove. If path has no default ACL, it
+// does nothing.
+func RemoveFromDefault(path string, keys ...Key) error {
+	return Options{}.RemoveFromDefault(path, keys...)
+}
+
+// RemoveFromDefaultWith removes entries from the default
+// ACL on path like RemoveFromDefault, but uses r to resolve
+// user and group names in the qualifiers of keys.
+func RemoveFromDefaultWith(path string, r Resolver, keys ...Key) error {
+	return Options{Resolver: r}.RemoveFromDefault(path, keys...)
+}
+
+// FRemoveFromDefault removes entries from the default
+// ACL like RemoveFromDefault, but on an *os.File.
+func FRemoveFromDefault(f *os.File, keys ...Key) error {
+	return Options{}.FRemoveFromDefault(f, keys...)
+}
+
+// Remove removes entries from the ACL on path like
+// the package-level Remove, but doesn't recalculate
+// the mask entry if o.NoMaskRecalc is true, and resolves
+// names in the qualifiers of keys with o.Resolver.
+func (o Options) Remove(path string, keys ...Key) error {
+	oldACL, err := get(path)
+	if err != nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !o.NoMaskRecalc, o.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", path, err)
+	}
+	return set(path, newACL)
+}
+
+// FRemove removes entries from the ACL like
+// Options.Remove, but on an *os.File.
+func (o Options) FRemove(f *os.File, keys ...Key) error {
+	oldACL, err := fget(f)
+	if err != nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !o.NoMaskRecalc, o.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", f.Name(), err)
+	}
+	return fset(f, newACL)
+}
+
+// RemoveFromDefault removes entries from the default
+// ACL on path like Options.Remove. If path has no
+// default ACL, it does nothing.
+func (o Options) RemoveFromDefault(path string, keys ...Key) error {
+	oldACL, err := getDefault(path)
+	if err != nil || oldACL == nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !o.NoMaskRecalc, o.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", path, err)
+	}
+	return setDefault(path, newACL)
+}
+
+// FRemoveFromDefault removes entries from the default
+// ACL like Options.RemoveFromDefault, but on an *os.File.
+func (o Options) FRemoveFromDefault(f *os.File, keys ...Key) error {
+	oldACL, err := fgetDefault(f)
+	if err != nil || oldACL == nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !o.NoMaskRecalc, o.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", f.Name(), err)
+	}
+	return fsetDefault(f, newACL)
+}
+
+// minimal returns the minimal ACL equivalent to the
+// permission bits of the file mode that a corresponds to:
+// all named user and group entries are removed, and if a
+// has a mask entry, its permissions become the permissions
+// of the TagGroupObj entry.
+func (a ACL) minimal() ACL {
+	var newACL ACL
+	mask, hasMask := a.Mask()
+	for _, e := range a {
+		switch e.Tag {
+		case TagUserObj, TagOther:
+			newACL = append(newACL, e)
+		case TagGroupObj:
+			if hasMask {
+				e.Perms = mask
+			}
+			newACL = append(newACL, e)
+		}
+	}
+	return newACL
+}
+
+// RemoveExtended removes all named user and group entries
+// and the mask entry from the access ACL on path, leaving
+// a minimal ACL equivalent to the file's permission bits
+// (like setfacl -b, but without removing the default ACL).
+// As the kernel does when reporting a file's mode, the
+// permissions of the mask entry, if any, are used as the
+// permissions of the file group, so the file's mode is
+// left unchanged.
+func RemoveExtended(path string) error {
+	oldACL, err := get(path)
+	if err != nil {
+		return err
+	}
+	return set(path, oldACL.minimal())
+}
+
+// FRemoveExtended removes extended entries from the
+// ACL like RemoveExtended, but on an *os.File.
+func FRemoveExtended(f *os.File) error {
+	oldACL, err := fget(f)
+	if err != nil {
+		return err
+	}
+	return fset(f, oldACL.minimal())
+}
+
+// RemoveDefault removes the default ACL from path (like
+// setfacl -k). If path has no default ACL, it does nothing.
+func RemoveDefault(path string) error {
+	return removeDefault(path)
+}
+
+// FRemoveDefault removes the default ACL like
+// RemoveDefault, but on an *os.File.
+func FRemoveDefault(f *os.File) error {
+	return fremoveDefault(f)
+}
@@ -0,0 +1,15 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build !darwin,!dragonfly,!freebsd,!netbsd,!openbsd
+
+package acl
+
+import "syscall"
+
+// errNoData is the error returned by getxattr if
+// the requested extended attribute doesn't exist.
+const errNoData = syscall.ENODATA
@@ -7,13 +7,11 @@
 package acl
 
 import (
-	"encoding/binary"
-	"fmt"
-	"math"
+	"io/ioutil"
 	"os"
-	"sort"
+	"path/filepath"
 	"strconv"
-	"sync"
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -34,23 +32,8 @@ const (
 	tagGroup         = 0x08
 	tagMask          = 0x10
 	tagOther         = 0x20
-
-	// defined in include/acl_ea.h (see libacl source)
-	aclEAAccess    = "system.posix_acl_access"
-	aclEADefault   = "system.posix_acl_default"
-	aclEAVersion   = 2
-	aclEAEntrySize = 8
-	aclUndefinedID = math.MaxUint32 // defined in sys/acl.h
 )
 
-const defaultbuflen = 64
-
-type fileObj interface {
-	Getxattr(attr string, dest []byte) (int, error)
-	Setxattr(attr string, dest []byte, flags int) error
-	Stat() (os.FileInfo, error)
-}
-
 type path string
 
 func (p path) Getxattr(attr string, dest []byte) (int, error) {
@@ -61,10 +44,68 @@ func (p path) Setxattr(attr string, dest []byte, flags int) error {
 	return syscall.Setxattr(string(p), attr, dest, flags)
 }
 
+func (p path) Removexattr(attr string) error {
+	return syscall.Removexattr(string(p), attr)
+}
+
 func (p path) Stat() (os.FileInfo, error) {
 	return os.Stat(string(p))
 }
 
+func (p path) Name() string {
+	return string(p)
+}
+
+type osBackend struct{}
+
+func (osBackend) Getxattr(p, attr string, dest []byte) (int, error) {
+	return path(p).Getxattr(attr, dest)
+}
+
+func (osBackend) Setxattr(p, attr string, data []byte, flags int) error {
+	return path(p).Setxattr(attr, data, flags)
+}
+
+func (osBackend) Removexattr(p, attr string) error {
+	return path(p).Removexattr(attr)
+}
+
+func (osBackend) Lgetxattr(p, attr string, dest []byte) (int, error) {
+	return lpath(p).Getxattr(attr, dest)
+}
+
+func (osBackend) Lsetxattr(p, attr string, data []byte, flags int) error {
+	return lpath(p).Setxattr(attr, data, flags)
+}
+
+func (osBackend) Lremovexattr(p, attr string) error {
+	return lpath(p).Removexattr(attr)
+}
+
+// lpath is like path, but doesn't follow
+// a symbolic link in the final component.
+type lpath string
+
+func (p lpath) Getxattr(attr string, dest []byte) (int, error) {
+	return unix.Lgetxattr(string(p), attr, dest)
+}
+
+func (p lpath) Setxattr(attr string, dest []byte, flags int) error {
+	return unix.Lsetxattr(string(p), attr, dest, flags)
+}
+
+func (p lpath) Removexattr(attr string) error {
+	return unix.Lremovexattr(string(p), attr)
+}
+
+func (p lpath) Stat() (os.FileInfo, error) {
+	return os.Lstat(string(p))
+}
+
+func (p lpath) Name() string {
+	return string(p)
+}
+
 type file struct {
 	*os.File
 }
@@ -77,10 +118,165 @@ func (f file) Setxattr(attr string, dest []byte, flags int) error {
 	return unix.Fsetxattr(int(f.Fd()), attr, dest, flags)
 }
 
+func (f file) Removexattr(attr string) error {
+	return unix.Fremovexattr(int(f.Fd()), attr)
+}
+
 func (f file) Stat() (os.FileInfo, error) {
 	return f.File.Stat()
 }
 
+// atFile is a file opened with O_PATH relative to a
+// directory. The xattr syscalls don't accept O_PATH
+// file descriptors, so its xattrs are accessed through
+// its /proc/self/fd entry, which refers to exactly the
+// file that was opened regardless of its path.
+type atFile struct {
+	*os.File
+	proc string
+}
+
+func (f atFile) Getxattr(attr string, dest []byte) (int, error) {
+	return syscall.Getxattr(f.proc, attr, dest)
+}
+
+func (f atFile) Setxattr(attr string, dest []byte, flags int) error {
+	return syscall.Setxattr(f.proc, attr, dest, flags)
+}
+
+func (f atFile) Removexattr(attr string) error {
+	return syscall.Removexattr(f.proc, attr)
+}
+
+func (f atFile) Stat() (os.FileInfo, error) {
+	return f.File.Stat()
+}
+
+// openAt opens name relative to dir with O_PATH, without
+// leaving dir or following any symbolic links.
+func openAt(dir *os.File, name string) (atFile, error) {
+	fullName := filepath.Join(dir.Name(), name)
+	fd, err := openBeneath(int(dir.Fd()), name)
+	if err != nil {
+		if err == syscall.ELOOP {
+			err = &sysError{ErrSymlink, err}
+		}
+		return atFile{}, pathError("openat", fullName, err)
+	}
+	f := atFile{os.NewFile(uintptr(fd), fullName), "/proc/self/fd/" + strconv.Itoa(fd)}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return atFile{}, err
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		// accessing the file through /proc/self/fd
+		// would follow the link
+		f.Close()
+		return atFile{}, pathError("openat", fullName, &sysError{ErrSymlink, syscall.ELOOP})
+	}
+	return f, nil
+}
+
+// openat2 is a variable so that tests can force
+// the fallback for kernels without openat2.
+var openat2 = unix.Openat2
+
+// openBeneath opens name relative to dirfd with O_PATH,
+// failing if resolving it leaves dirfd or involves any
+// symbolic links. An empty name is rejected with ENOENT,
+// as by openat2, rather than opening dirfd itself.
+func openBeneath(dirfd int, name string) (int, error) {
+	if name == "" {
+		return -1, syscall.ENOENT
+	}
+	fd, err := openat2(dirfd, name, &unix.OpenHow{
+		Flags:   unix.O_PATH | unix.O_CLOEXEC,
+		Resolve: unix.RESOLVE_BENEATH | unix.RESOLVE_NO_SYMLINKS,
+	})
+	if err != syscall.ENOSYS && err != syscall.EPERM {
+		return fd, err
+	}
+	// openat2 is only available since Linux 5.6, and
+	// some seccomp profiles reject it with EPERM
+	return openBeneathCompat(dirfd, name)
+}
+
+// openBeneathCompat is like openBeneath, but resolves
+// name one component at a time. Since each component
+// is opened with O_NOFOLLOW, a symbolic link before the
+// final component results in ENOTDIR when opening the
+// next one, and a symbolic link in the final component
+// is opened itself.
+func openBeneathCompat(dirfd int, name string) (int, error) {
+	if filepath.IsAbs(name) {
+		return -1, syscall.EXDEV
+	}
+	fd := -1
+	for _, c := range strings.Split(name, "/") {
+		if c == "" || c == "." {
+			continue
+		}
+		if c == ".." {
+			if fd != -1 {
+				unix.Close(fd)
+			}
+			return -1, syscall.EXDEV
+		}
+		parent := dirfd
+		if fd != -1 {
+			parent = fd
+		}
+		next, err := unix.Openat(parent, c, unix.O_PATH|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		if fd != -1 {
+			unix.Close(fd)
+		}
+		if err != nil {
+			return -1, err
+		}
+		fd = next
+	}
+	if fd == -1 {
+		return unix.Openat(dirfd, ".", unix.O_PATH|unix.O_CLOEXEC, 0)
+	}
+	return fd, nil
+}
+
+func getAt(dir *os.File, name string) (ACL, error) {
+	f, err := openAt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return getType(f, aclEAAccess)
+}
+
+func getDefaultAt(dir *os.File, name string) (ACL, error) {
+	f, err := openAt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return getType(f, aclEADefault)
+}
+
+func setAt(dir *os.File, name string, acl ACL) error {
+	return setTypeAt(dir, name, aclEAAccess, acl)
+}
+
+func setDefaultAt(dir *os.File, name string, acl ACL) error {
+	return setTypeAt(dir, name, aclEADefault, acl)
+}
+
+func setTypeAt(dir *os.File, name, attr string, acl ACL) error {
+	f, err := openAt(dir, name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return setType(f, attr, acl)
+}
+
 func get(p string) (ACL, error) {
 	return getType(path(p), aclEAAccess)
 }
@@ -113,155 +309,157 @@ func fsetDefault(f *os.File, acl ACL) error {
 	return setType(file{f}, aclEADefault, acl)
 }
 
-func xattrFromACL(acl ACL) (xattr []byte, err error) {
-	// NOTE(joshlf): I honestly don't know why sorting is required -
-	// all I know is that when the entries are left unsorted, the
-	// setxattrs syscall sometimes returns EINVAL, but when they're
-	// sorted, it never does. I can't find either documentation or
-	// kernel code to explain this behavior. The only evidence is
-	// the source code for libacl's acl_check, which checks the order.
-	acl = append(ACL(nil), acl...)
-	sort.Sort(sortableACL(acl))
-
-	xattr = make([]byte, 4+8*len(acl))
-	binary.LittleEndian.PutUint32(xattr, aclEAVersion)
-	xattrtmp := xattr[4:]
-	for _, ent := range acl {
-		binary.LittleEndian.PutUint16(xattrtmp, uint16(ent.Tag))
-		binary.LittleEndian.PutUint16(xattrtmp[2:], uint16(ent.Perms))
-		if ent.Tag == TagUser || ent.Tag == TagGroup {
-			qid, err := strconv.ParseUint(ent.Qualifier, 10, 32)
-			if err != nil {
-				return nil, fmt.Errorf("parse qualifier: %v", err)
-			}
-			binary.LittleEndian.PutUint32(xattrtmp[4:], uint32(qid))
-		} else {
-			binary.LittleEndian.PutUint32(xattrtmp[4:], aclUndefinedID)
-		}
-		xattrtmp = xattrtmp[8:]
-	}
-	return xattr, nil
-}
-
-// sort according to the same order as required by libacl's acl_check
-
-func entryPriority(e Entry) int {
-	switch e.Tag {
-	case TagUserObj:
-		return 0
-	case TagUser:
-		return 1
-	case TagGroupObj:
-		return 2
-	case TagGroup:
-		return 3
-	case TagMask:
-		return 4
-	default:
-		return 5
-	}
+func lget(p string) (ACL, error) {
+	return getType(lpath(p), aclEAAccess)
 }
 
-type sortableACL ACL
+func lgetDefault(p string) (ACL, error) {
+	return getType(lpath(p), aclEADefault)
+}
 
-func (s sortableACL) Len() int { return len(s) }
-func (s sortableACL) Less(i, j int) bool {
-	return entryPriority(s[i]) < entryPriority(s[j])
+func lset(p string, acl ACL) error {
+	return setType(lpath(p), aclEAAccess, acl)
 }
-func (s sortableACL) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
 
-func aclFromXattr(xattr []byte) (acl ACL, err error) {
-	if len(xattr) < 4 {
-		return nil, syscall.EINVAL
-	}
-	version := binary.LittleEndian.Uint32(xattr)
-	xattr = xattr[4:]
-	if version != aclEAVersion {
-		return nil, syscall.EINVAL
-	}
-	if len(xattr)%aclEAEntrySize != 0 {
-		return nil, syscall.EINVAL
-	}
+func lsetDefault(p string, acl ACL) error {
+	return setType(lpath(p), aclEADefault, acl)
+}
 
-	for len(xattr) > 0 {
-		etag := binary.LittleEndian.Uint16(xattr)
-		sperm := binary.LittleEndian.Uint16(xattr[2:])
-		qid := binary.LittleEndian.Uint32(xattr[4:])
+func removeDefault(p string) error {
+	return removeType(path(p), aclEADefault)
+}
 
-		ent := Entry{
-			Tag:   Tag(etag),
-			Perms: os.FileMode(sperm),
-		}
-		if ent.Tag == TagUser || ent.Tag == TagGroup {
-			ent.Qualifier = fmt.Sprint(qid)
-		}
+func fremoveDefault(f *os.File) error {
+	return removeType(file{f}, aclEADefault)
+}
 
-		acl = append(acl, ent)
-		xattr = xattr[8:]
+// sysFileOwner returns the UID and GID of the owner
+// of the file described by fi, as returned by os.Stat.
+func sysFileOwner(fi os.FileInfo) (uid, gid uint32, ok bool) {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
 	}
-
-	return acl, nil
+	return st.Uid, st.Gid, true
 }
 
-// based on libacl's acl_get_file
-func getType(f fileObj, attr string) (ACL, error) {
-	buf := bufpool.Get().([]byte)
-	defer func() { bufpool.Put(buf) }()
-
-	sz, err := f.Getxattr(attr, buf)
-	if sz == -1 && err == syscall.ERANGE {
-		sz, err = f.Getxattr(attr, nil)
-		if sz <= 0 {
-			return nil, err
-		}
-		buf = make([]byte, sz)
-		sz, err = f.Getxattr(attr, buf)
+func create(name string, acl ACL) (*os.File, error) {
+	dir := filepath.Dir(name)
+	fd, err := unix.Open(dir, unix.O_TMPFILE|unix.O_RDWR|unix.O_CLOEXEC, 0600)
+	switch err {
+	case nil:
+	case syscall.EISDIR, syscall.EOPNOTSUPP:
+		// kernels which don't know about O_TMPFILE
+		// open the directory itself and fail with
+		// EISDIR; filesystems which don't support
+		// it fail with EOPNOTSUPP
+		return createNoPerms(name, acl)
+	default:
+		return nil, &os.PathError{Op: "open", Path: dir, Err: err}
 	}
 
-	switch {
-	case sz > 0:
-		return aclFromXattr(buf[:sz])
-	case err == syscall.ENODATA:
-		// TODO(joshlf): acl_get_file also checks for ENOATTR,
-		// but it's not defined in syscall?
-		fi, err := f.Stat()
-		if err != nil {
-			return nil, err
-		}
-		if attr == aclEADefault {
-			if fi.IsDir() {
-				return nil, nil
-			}
-			return nil, syscall.EACCES
-		} else {
-			return FromUnix(fi.Mode()), nil
-		}
-	default:
+	f := os.NewFile(uintptr(fd), name)
+	if err := FSet(f, acl); err != nil {
+		f.Close()
 		return nil, err
 	}
+	// linking an O_TMPFILE file by its file descriptor
+	// (with AT_EMPTY_PATH) requires CAP_DAC_READ_SEARCH,
+	// but linking its /proc/self/fd entry does not
+	proc := "/proc/self/fd/" + strconv.Itoa(fd)
+	if err := unix.Linkat(unix.AT_FDCWD, proc, unix.AT_FDCWD, name, unix.AT_SYMLINK_FOLLOW); err != nil {
+		f.Close()
+		return nil, &os.LinkError{Op: "link", Old: proc, New: name, Err: err}
+	}
+	return f, nil
 }
 
-// based on libacl's acl_set_file
-func setType(f fileObj, attr string, acl ACL) error {
-	if attr == aclEADefault {
-		fi, err := f.Stat()
-		if err != nil {
-			return err
-		}
-
-		// non-directories can't have default ACLs
-		if !fi.IsDir() {
-			return syscall.EACCES
-		}
+// createNoPerms creates name with no permissions
+// and then sets its ACL.
+func createNoPerms(name string, acl ACL) (*os.File, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0)
+	if err != nil {
+		return nil, err
 	}
+	if err := FSet(f, acl); err != nil {
+		f.Close()
+		os.Remove(name)
+		return nil, err
+	}
+	return f, nil
+}
 
-	xattr, err := xattrFromACL(acl)
+func mkdir(name string, access, def ACL) error {
+	tmp, err := ioutil.TempDir(filepath.Dir(name), "."+filepath.Base(name)+".")
 	if err != nil {
 		return err
 	}
-	return f.Setxattr(attr, xattr, 0)
+	if err := (FS{Backend: OSBackend}).setDirACLs(tmp, access, def); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	err = unix.Renameat2(unix.AT_FDCWD, tmp, unix.AT_FDCWD, name, unix.RENAME_NOREPLACE)
+	switch err {
+	case nil:
+		return nil
+	case syscall.ENOSYS, syscall.EINVAL:
+		// the kernel or filesystem doesn't
+		// support RENAME_NOREPLACE
+		os.Remove(tmp)
+		return mkdirNoPerms(name, access, def)
+	default:
+		os.Remove(tmp)
+		return &os.LinkError{Op: "rename", Old: tmp, New: name, Err: err}
+	}
 }
 
-var bufpool = sync.Pool{
-	New: func() interface{} { return make([]byte, defaultbuflen) },
+// mkdirNoPerms creates name with no permissions
+// and then sets its ACLs.
+func mkdirNoPerms(name string, access, def ACL) error {
+	if err := os.Mkdir(name, 0); err != nil {
+		return err
+	}
+	if err := (FS{Backend: OSBackend}).setDirACLs(name, access, def); err != nil {
+		os.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// openFileBeneath opens the regular file name beneath the
+// directory root for reading, failing with an error
+// matching ErrSymlink if its final component is a symbolic
+// link. The path is resolved one component at a time with
+// O_NOFOLLOW, so a symbolic link in an earlier component
+// results in ENOTDIR. The file is opened with O_NONBLOCK
+// so that a FIFO in its place can't block the caller,
+// and anything other than a regular file is rejected.
+func openFileBeneath(root, name string) (*os.File, error) {
+	fullName := filepath.Join(root, name)
+	fd, err := unix.Open(root, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+	components := strings.Split(filepath.ToSlash(name), "/")
+	for i, c := range components {
+		flags := unix.O_PATH | unix.O_DIRECTORY
+		if i == len(components)-1 {
+			flags = unix.O_RDONLY | unix.O_NONBLOCK
+		}
+		next, err := unix.Openat(fd, c, flags|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+		unix.Close(fd)
+		if err != nil {
+			if err == syscall.ELOOP {
+				err = &sysError{ErrSymlink, err}
+			}
+			return nil, pathError("open", fullName, err)
+		}
+		fd = next
+	}
+	f := os.NewFile(uintptr(fd), fullName)
+	if err := checkRegular(f); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
 }
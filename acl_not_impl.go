@@ -10,6 +10,8 @@ package acl
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
@@ -28,34 +30,150 @@ const (
 	tagOther
 )
 
+type osBackend struct{}
+
+func (osBackend) Getxattr(path, attr string, dest []byte) (int, error) {
+	return -1, syscall.ENOTSUP
+}
+
+func (osBackend) Setxattr(path, attr string, data []byte, flags int) error {
+	return syscall.ENOTSUP
+}
+
+func (osBackend) Removexattr(path, attr string) error {
+	return syscall.ENOTSUP
+}
+
+func (osBackend) Lgetxattr(path, attr string, dest []byte) (int, error) {
+	return -1, syscall.ENOTSUP
+}
+
+func (osBackend) Lsetxattr(path, attr string, data []byte, flags int) error {
+	return syscall.ENOTSUP
+}
+
+func (osBackend) Lremovexattr(path, attr string) error {
+	return syscall.ENOTSUP
+}
+
 func get(path string) (ACL, error) {
-	return nil, syscall.ENOTSUP
+	return nil, pathError("get", path, syscall.ENOTSUP)
 }
 
 func fget(f *os.File) (ACL, error) {
-	return nil, syscall.ENOTSUP
+	return nil, pathError("get", f.Name(), syscall.ENOTSUP)
 }
 
 func getDefault(path string) (ACL, error) {
-	return nil, syscall.ENOTSUP
+	return nil, pathError("getdefault", path, syscall.ENOTSUP)
 }
 
 func fgetDefault(f *os.File) (ACL, error) {
-	return nil, syscall.ENOTSUP
+	return nil, pathError("getdefault", f.Name(), syscall.ENOTSUP)
 }
 
 func set(path string, acl ACL) error {
-	return syscall.ENOTSUP
+	return pathError("set", path, syscall.ENOTSUP)
 }
 
 func fset(f *os.File, acl ACL) error {
-	return syscall.ENOTSUP
+	return pathError("set", f.Name(), syscall.ENOTSUP)
 }
 
 func setDefault(path string, acl ACL) error {
-	return syscall.ENOTSUP
+	return pathError("setdefault", path, syscall.ENOTSUP)
 }
 
 func fsetDefault(f *os.File, acl ACL) error {
-	return syscall.ENOTSUP
+	return pathError("setdefault", f.Name(), syscall.ENOTSUP)
+}
+
+func lget(path string) (ACL, error) {
+	return nil, pathError("get", path, syscall.ENOTSUP)
+}
+
+func lgetDefault(path string) (ACL, error) {
+	return nil, pathError("getdefault", path, syscall.ENOTSUP)
+}
+
+func lset(path string, acl ACL) error {
+	return pathError("set", path, syscall.ENOTSUP)
+}
+
+func lsetDefault(path string, acl ACL) error {
+	return pathError("setdefault", path, syscall.ENOTSUP)
+}
+
+func getAt(dir *os.File, name string) (ACL, error) {
+	return nil, pathError("get", filepath.Join(dir.Name(), name), syscall.ENOTSUP)
+}
+
+func getDefaultAt(dir *os.File, name string) (ACL, error) {
+	return nil, pathError("getdefault", filepath.Join(dir.Name(), name), syscall.ENOTSUP)
+}
+
+func setAt(dir *os.File, name string, acl ACL) error {
+	return pathError("set", filepath.Join(dir.Name(), name), syscall.ENOTSUP)
+}
+
+func setDefaultAt(dir *os.File, name string, acl ACL) error {
+	return pathError("setdefault", filepath.Join(dir.Name(), name), syscall.ENOTSUP)
+}
+
+func sysFileOwner(fi os.FileInfo) (uid, gid uint32, ok bool) {
+	return 0, 0, false
+}
+
+func removeDefault(path string) error {
+	return pathError("removedefault", path, syscall.ENOTSUP)
+}
+
+func fremoveDefault(f *os.File) error {
+	return pathError("removedefault", f.Name(), syscall.ENOTSUP)
+}
+
+func create(name string, acl ACL) (*os.File, error) {
+	return nil, pathError("create", name, syscall.ENOTSUP)
+}
+
+func mkdir(name string, access, def ACL) error {
+	return pathError("mkdir", name, syscall.ENOTSUP)
+}
+
+// openFileBeneath opens the regular file name beneath the
+// directory root for reading, failing with an error
+// matching ErrSymlink if resolving it involves any
+// symbolic links. Each component is checked with Lstat,
+// and the opened file is checked against the result for
+// the final one. The file is opened with O_NONBLOCK so
+// that a FIFO in its place can't block the caller, and
+// anything other than a regular file is rejected.
+func openFileBeneath(root, name string) (*os.File, error) {
+	path := root
+	var fi os.FileInfo
+	for _, c := range strings.Split(filepath.ToSlash(name), "/") {
+		path = filepath.Join(path, c)
+		var err error
+		if fi, err = os.Lstat(path); err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil, pathError("open", path, &sysError{ErrSymlink, syscall.ELOOP})
+		}
+	}
+	if !fi.Mode().IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: path, Err: errNotRegular}
+	}
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+	if ofi, err := f.Stat(); err != nil || !os.SameFile(fi, ofi) {
+		f.Close()
+		if err == nil {
+			err = pathError("open", path, &sysError{ErrSymlink, syscall.ELOOP})
+		}
+		return nil, err
+	}
+	return f, nil
 }
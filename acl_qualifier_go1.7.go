@@ -8,25 +8,53 @@
 
 package acl
 
-import "os/user"
+import (
+	"os/user"
+	"strconv"
+)
 
 func init() {
-	formatQualifier = func(q string, tag Tag) string {
-		switch tag {
-		case TagUser:
-			usr, err := user.LookupId(q)
-			if err != nil {
-				return q
-			}
-			return usr.Username
-		case TagGroup:
-			grp, err := user.LookupGroupId(q)
-			if err != nil {
-				return q
-			}
-			return grp.Name
-		default:
-			return q
-		}
+	defaultResolver = OSResolver{}
+}
+
+// OSResolver is a Resolver which uses the system's user
+// and group database (as provided by the os/user package).
+type OSResolver struct{}
+
+// UserName implements Resolver.
+func (OSResolver) UserName(uid UID) (string, error) {
+	usr, err := user.LookupId(strconv.FormatUint(uint64(uid), 10))
+	if err != nil {
+		return "", err
+	}
+	return usr.Username, nil
+}
+
+// GroupName implements Resolver.
+func (OSResolver) GroupName(gid GID) (string, error) {
+	grp, err := user.LookupGroupId(strconv.FormatUint(uint64(gid), 10))
+	if err != nil {
+		return "", err
+	}
+	return grp.Name, nil
+}
+
+// LookupUser implements Resolver.
+func (OSResolver) LookupUser(name string) (UID, error) {
+	usr, err := user.Lookup(name)
+	if err != nil {
+		return 0, err
+	}
+	uid, err := strconv.ParseUint(usr.Uid, 10, 32)
+	return UID(uid), err
+}
+
+// LookupGroup implements Resolver.
+func (OSResolver) LookupGroup(name string) (GID, error) {
+	grp, err := user.LookupGroup(name)
+	if err != nil {
+		return 0, err
 	}
+	gid, err := strconv.ParseUint(grp.Gid, 10, 32)
+	return GID(gid), err
 }
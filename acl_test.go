@@ -228,6 +228,196 @@ func TestFAdd(t *testing.T) {
 	}
 }
 
+var removeTestCases = []struct {
+	Before ACL
+	Remove []Key
+	After  ACL
+}{
+	// Make sure mask is recalculated
+	{
+		append(ACL{{TagUser, "0", 4}, {TagGroup, "0", 2}, {TagMask, "", 7}}, base...),
+		[]Key{{TagUser, "0"}},
+		append(ACL{{TagGroup, "0", 2}, {TagMask, "", 2}}, base...),
+	},
+	// Make sure names are resolved and mask is kept
+	{
+		append(ACL{{TagUser, "0", 4}, {TagMask, "", 7}}, base...),
+		[]Key{{TagUser, "root"}},
+		append(ACL{{TagMask, "", 0}}, base...),
+	},
+	// Make sure the mask can be removed with the last named entry
+	{
+		append(ACL{{TagUser, "0", 4}, {TagMask, "", 4}}, base...),
+		[]Key{{TagUser, "0"}, {TagMask, "x"}},
+		base,
+	},
+	// Make sure missing entries are ignored
+	{
+		base,
+		[]Key{{TagGroup, "0"}},
+		base,
+	},
+}
+
+func TestRemove(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+
+	for i, c := range removeTestCases {
+		err := Set(f, c.Before)
+		testutil.Must(t, err)
+		err = Remove(f, c.Remove...)
+		testutil.Must(t, err)
+		acl, err := Get(f)
+		testutil.Must(t, err)
+
+		m1 := make(map[Entry]bool)
+		m2 := make(map[Entry]bool)
+		for _, e := range acl {
+			m1[e] = true
+		}
+		for _, e := range c.After {
+			m2[e] = true
+		}
+
+		if !reflect.DeepEqual(m1, m2) {
+			t.Errorf("case %v: unexpected ACL: want %v; got %v", i, c.After, acl)
+		}
+	}
+
+	testutil.Must(t, Set(f, append(ACL{{TagUser, "0", 4}, {TagMask, "", 4}}, base...)))
+	for _, k := range []Key{{Tag: TagUserObj}, {Tag: TagGroupObj}, {Tag: TagOther}, {Tag: TagMask}} {
+		if err := Remove(f, k); err == nil {
+			t.Errorf("removing entry with tag %v: expected error", k.Tag.StringLong())
+		}
+	}
+
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.Remove(d)
+	dir, err := os.Open(d)
+	testutil.Must(t, err)
+	defer dir.Close()
+	testutil.Must(t, RemoveFromDefault(d, Key{TagUser, "0"}))
+	testutil.Must(t, SetDefault(d, append(ACL{{TagUser, "0", 4}, {TagGroup, "0", 1}, {TagMask, "", 5}}, base...)))
+	testutil.Must(t, FRemoveFromDefault(dir, Key{TagUser, "0"}))
+	dacl, err := GetDefault(d)
+	testutil.Must(t, err)
+	want := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "0", 1}, {TagMask, "", 1}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(dacl, want) {
+		t.Errorf("unexpected default ACL: want %v; got %v", want, dacl)
+	}
+}
+
+func TestRecalculateMask(t *testing.T) {
+	for i, test := range []struct {
+		acl, want ACL
+	}{
+		{
+			append(ACL{{TagUser, "0", 4}, {TagGroup, "0", 2}, {TagMask, "", 7}}, base...),
+			append(ACL{{TagUser, "0", 4}, {TagGroup, "0", 2}, {TagMask, "", 6}}, base...),
+		},
+		// TagGroupObj is affected by the mask
+		{
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagOther, "", 0}},
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagOther, "", 0}, {TagMask, "", 5}},
+		},
+		{
+			append(ACL{{TagMask, "", 7}}, base...),
+			append(ACL{{TagMask, "", 0}}, base...),
+		},
+		// minimal ACLs don't get a mask
+		{base, base},
+	} {
+		before := append(ACL(nil), test.acl...)
+		if got := test.acl.RecalculateMask(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: unexpected ACL: want %v; got %v", i, test.want, got)
+		}
+		if !reflect.DeepEqual(test.acl, before) {
+			t.Errorf("%v: RecalculateMask modified its receiver", i)
+		}
+	}
+}
+
+func TestNoMaskRecalc(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+
+	// the kernel orders entries by tag
+	getACL := func() ACL {
+		acl, err := Get(f)
+		testutil.Must(t, err)
+		return acl
+	}
+	before := ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagGroup, "0", 2}, {TagMask, "", 4}, {TagOther, "", 0}}
+	for i, test := range []struct {
+		opts   Options
+		modify func(o Options) error
+		want   ACL
+	}{
+		// setfacl -m g::x
+		{
+			Options{},
+			func(o Options) error { return o.Add(f, Entry{Tag: TagGroupObj, Perms: 1}) },
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagGroup, "0", 2}, {TagMask, "", 7}, {TagOther, "", 0}},
+		},
+		// setfacl -n -m g::x
+		{
+			Options{NoMaskRecalc: true},
+			func(o Options) error { return o.Add(f, Entry{Tag: TagGroupObj, Perms: 1}) },
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagGroup, "0", 2}, {TagMask, "", 4}, {TagOther, "", 0}},
+		},
+		// setfacl -x u:0
+		{
+			Options{},
+			func(o Options) error { return o.Remove(f, Key{TagUser, "0"}) },
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "0", 2}, {TagMask, "", 2}, {TagOther, "", 0}},
+		},
+		// setfacl -n -x u:0
+		{
+			Options{NoMaskRecalc: true},
+			func(o Options) error { return o.Remove(f, Key{TagUser, "0"}) },
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "0", 2}, {TagMask, "", 4}, {TagOther, "", 0}},
+		},
+		// setfacl --set u::rwx,u:0:rw,g::-,o::-
+		{
+			Options{},
+			func(o Options) error {
+				return o.Set(f, ACL{{TagUserObj, "", 7}, {TagUser, "0", 6}, {TagGroupObj, "", 0}, {TagOther, "", 0}})
+			},
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 6}, {TagGroupObj, "", 0}, {TagMask, "", 6}, {TagOther, "", 0}},
+		},
+		// the package-level Add keeps an existing mask
+		// unless named entries are added
+		{
+			Options{},
+			func(Options) error { return Add(f, Entry{Tag: TagGroupObj, Perms: 1}) },
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagGroup, "0", 2}, {TagMask, "", 4}, {TagOther, "", 0}},
+		},
+		{
+			Options{},
+			func(Options) error { return Add(f, Entry{TagGroup, "0", 1}) },
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagGroup, "0", 1}, {TagMask, "", 5}, {TagOther, "", 0}},
+		},
+	} {
+		testutil.Must(t, Set(f, before))
+		testutil.Must(t, test.modify(test.opts))
+		if got := getACL(); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: unexpected ACL: want %v; got %v", i, test.want, got)
+		}
+	}
+
+	// a mask is required, so it is added even without recalculation
+	testutil.Must(t, Set(f, base))
+	testutil.Must(t, Options{NoMaskRecalc: true}.Add(f, Entry{TagUser, "0", 6}))
+	want := ACL{{TagUserObj, "", 7}, {TagUser, "0", 6}, {TagGroupObj, "", 0}, {TagMask, "", 6}, {TagOther, "", 0}}
+	if got := getACL(); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, got)
+	}
+	if err := (Options{NoMaskRecalc: true}).Set(f, ACL{{TagUserObj, "", 7}, {TagUser, "0", 6}, {TagGroupObj, "", 0}, {TagOther, "", 0}}); err == nil {
+		t.Errorf("expected error setting ACL without mask")
+	}
+}
+
 func TestDefault(t *testing.T) {
 	d := testutil.MustTempDir(t, "", "acl")
 	defer os.RemoveAll(d)
@@ -260,6 +450,100 @@ func TestDefault(t *testing.T) {
 	}
 }
 
+func TestInherit(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	dacls := []ACL{
+		{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 5}},
+		{{TagUserObj, "", 7}, {TagUser, "0", 7}, {TagGroupObj, "", 7}, {TagMask, "", 6}, {TagOther, "", 1}},
+	}
+	for i, dacl := range dacls {
+		testutil.Must(t, SetDefault(d, dacl))
+		for _, mode := range []os.FileMode{0777, 0750, 0604, 0} {
+			name := filepath.Join(d, fmt.Sprintf("%v-%o", i, mode))
+			f, err := os.OpenFile(name+"-file", os.O_CREATE|os.O_EXCL, mode)
+			testutil.Must(t, err)
+			f.Close()
+			testutil.Must(t, os.Mkdir(name+"-dir", mode))
+
+			for _, isDir := range []bool{false, true} {
+				path := name + "-file"
+				if isDir {
+					path = name + "-dir"
+				}
+				wantAccess, wantDefault := Inherit(dacl, mode, isDir)
+				access, err := Get(path)
+				testutil.Must(t, err)
+				def, err := GetDefault(path)
+				if !isDir {
+					def, err = nil, nil
+				}
+				testutil.Must(t, err)
+				if !reflect.DeepEqual(access, wantAccess) || !reflect.DeepEqual(def, wantDefault) {
+					t.Errorf("unexpected ACLs for %v: want %v and %v; got %v and %v",
+						path, wantAccess, wantDefault, access, def)
+				}
+			}
+		}
+	}
+}
+
+func TestChmod(t *testing.T) {
+	f1 := testutil.MustTempFile(t, "", "acl")
+	defer os.Remove(f1.Name())
+	defer f1.Close()
+	f2 := testutil.MustTempFile(t, "", "acl")
+	defer os.Remove(f2.Name())
+	defer f2.Close()
+
+	for i, test := range []struct {
+		acl  ACL
+		mode os.FileMode
+		want ACL
+	}{
+		{
+			ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagOther, "", 4}},
+			0751,
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 1}},
+		},
+		{
+			ACL{{TagUserObj, "", 6}, {TagUser, "0", 7}, {TagGroupObj, "", 6}, {TagMask, "", 7}, {TagOther, "", 4}},
+			0640,
+			ACL{{TagUserObj, "", 6}, {TagUser, "0", 7}, {TagGroupObj, "", 6}, {TagMask, "", 4}, {TagOther, "", 0}},
+		},
+		{
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagMask, "", 0}, {TagOther, "", 0}},
+			os.ModeSetuid | 0777,
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagMask, "", 7}, {TagOther, "", 7}},
+		},
+	} {
+		if got := test.acl.Chmod(test.mode); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: unexpected ACL: want %v; got %v", i, test.want, got)
+		}
+		if got, want := ToMode(test.want), test.mode.Perm(); got != want {
+			t.Errorf("%v: unexpected mode: want %v; got %v", i, want, got)
+		}
+
+		// make sure that Chmod agrees with the kernel
+		testutil.Must(t, FSet(f1, test.acl))
+		testutil.Must(t, FSet(f2, test.acl))
+		testutil.Must(t, FChmod(f1, test.mode))
+		testutil.Must(t, f2.Chmod(test.mode.Perm()))
+		acl1, err := FGet(f1)
+		testutil.Must(t, err)
+		acl2, err := FGet(f2)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(acl1, acl2) {
+			t.Errorf("%v: unexpected ACL after FChmod: want %v; got %v", i, acl2, acl1)
+		}
+		fi, err := f1.Stat()
+		testutil.Must(t, err)
+		if got, want := ToMode(acl1), fi.Mode().Perm(); got != want {
+			t.Errorf("%v: ToMode disagrees with stat: want %v; got %v", i, want, got)
+		}
+	}
+}
+
 var (
 	userObj  = Entry{Tag: TagUserObj}
 	groupObj = Entry{Tag: TagGroupObj}
@@ -425,3 +709,119 @@ func ExampleString() {
 	// group:root:-w-
 	// mask::-w-
 }
+
+func TestEffectivePerms(t *testing.T) {
+	acl := ACL{
+		{TagUserObj, "", 7},
+		{TagUser, "0", 6},
+		{TagGroupObj, "", 1},
+		{TagGroup, "0", 4},
+		{TagMask, "", 5},
+		{TagOther, "", 7},
+	}
+	want := []os.FileMode{7, 4, 1, 4, 5, 7}
+	if perms := acl.EffectivePerms(); !reflect.DeepEqual(perms, want) {
+		t.Errorf("unexpected effective permissions: want %v; got %v", want, perms)
+	}
+	if reduced := acl.ReducedByMask(); !reflect.DeepEqual(reduced, []Entry{acl[1]}) {
+		t.Errorf("unexpected entries reduced by mask: want %v; got %v", []Entry{acl[1]}, reduced)
+	}
+
+	// Without a mask, nothing is reduced
+	acl = FromUnix(0751)
+	want = []os.FileMode{7, 5, 1}
+	if perms := acl.EffectivePerms(); !reflect.DeepEqual(perms, want) {
+		t.Errorf("unexpected effective permissions: want %v; got %v", want, perms)
+	}
+	if reduced := acl.ReducedByMask(); reduced != nil {
+		t.Errorf("unexpected entries reduced by mask: want none; got %v", reduced)
+	}
+}
+
+func TestRemoveExtended(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl")
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	testutil.Must(t, FSet(f, ACL{{TagUserObj, "", 6}, {TagUser, "0", 7}, {TagGroupObj, "", 4},
+		{TagMask, "", 5}, {TagOther, "", 1}}))
+	testutil.Must(t, RemoveExtended(f.Name()))
+	acl, err := FGet(f)
+	testutil.Must(t, err)
+	if want := FromUnix(0651); !reflect.DeepEqual(acl, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl)
+	}
+	fi, err := f.Stat()
+	testutil.Must(t, err)
+	if fi.Mode().Perm() != 0651 {
+		t.Errorf("unexpected mode: want %v; got %v", os.FileMode(0651), fi.Mode().Perm())
+	}
+	testutil.Must(t, FRemoveExtended(f))
+
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.Remove(d)
+	testutil.Must(t, RemoveDefault(d))
+	testutil.Must(t, SetDefault(d, FromUnix(0750)))
+	testutil.Must(t, RemoveDefault(d))
+	dacl, err := GetDefault(d)
+	testutil.Must(t, err)
+	if dacl != nil {
+		t.Errorf("unexpected default ACL: want none; got %v", dacl)
+	}
+}
+
+func TestConditionalExecute(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl")
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(f.Name())
+	}()
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.Remove(d)
+
+	acl, err := Parse("u::rwX,g::r-X,o::---")
+	testutil.Must(t, err)
+	if s := acl.String(); s != "u::rwX,g::r-X,o::---" {
+		t.Errorf("unexpected text: want u::rwX,g::r-X,o::---; got %v", s)
+	}
+
+	o := Options{ConditionalExecute: true}
+
+	// Not granted to a file without execute permissions
+	testutil.Must(t, o.FSet(f, acl))
+	acl2, err := FGet(f)
+	testutil.Must(t, err)
+	if want := FromUnix(0640); !reflect.DeepEqual(acl2, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl2)
+	}
+
+	// Granted to a file with execute permissions
+	testutil.Must(t, os.Chmod(f.Name(), 0700))
+	testutil.Must(t, o.Add(f.Name(), Entry{TagUser, "0", 4 | ConditionalExecute}))
+	acl2, err = FGet(f)
+	testutil.Must(t, err)
+	want := ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 0}, {TagMask, "", 5}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(acl2, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl2)
+	}
+
+	// Granted to a directory
+	testutil.Must(t, o.Set(d, acl))
+	acl2, err = Get(d)
+	testutil.Must(t, err)
+	if want := FromUnix(0750); !reflect.DeepEqual(acl2, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl2)
+	}
+
+	// Ignored unless enabled, so that permissions taken
+	// from an unmasked mode don't grant execute permission
+	testutil.Must(t, Set(d, acl))
+	testutil.Must(t, Add(d, Entry{TagUser, "0", 0640 >> 3}))
+	acl2, err = Get(d)
+	testutil.Must(t, err)
+	want = ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(acl2, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl2)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// GetAt retrieves the access ACL of the file name, which
+// is resolved relative to the directory dir. name may have
+// several components, but resolving it must not leave dir
+// (for example, through ".." or an absolute path) and must
+// not involve any symbolic links, including in its final
+// component. Since dir is held open, this makes GetAt and
+// the other At functions safe to use on trees in which
+// untrusted users can rename files or create symbolic links.
+//
+// On Linux, name is resolved with openat2 and the
+// RESOLVE_BENEATH and RESOLVE_NO_SYMLINKS flags where
+// available, and one component at a time otherwise. If the
+// final component is a symbolic link, an error matching
+// ErrSymlink is returned.
+func GetAt(dir *os.File, name string) (ACL, error) {
+	return getAt(dir, name)
+}
+
+// GetDefaultAt retrieves the default ACL of the file
+// name, which is resolved relative to the directory dir
+// as described in the documentation for GetAt.
+func GetDefaultAt(dir *os.File, name string) (ACL, error) {
+	return getDefaultAt(dir, name)
+}
+
+// SetAt sets the access ACL of the file name, which
+// is resolved relative to the directory dir as described
+// in the documentation for GetAt.
+func SetAt(dir *os.File, name string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return pathError("set", filepath.Join(dir.Name(), name), err)
+	}
+	return setAt(dir, name, acl)
+}
+
+// SetDefaultAt sets the default ACL of the file name,
+// which is resolved relative to the directory dir as
+// described in the documentation for GetAt.
+func SetDefaultAt(dir *os.File, name string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return pathError("setdefault", filepath.Join(dir.Name(), name), err)
+	}
+	return setDefaultAt(dir, name, acl)
+}
+
+// GetAt retrieves the access ACL of the file name, which
+// is resolved relative to the directory dir like the
+// package-level GetAt. Since a Backend can't hold dir open,
+// each component of name is instead checked with Lstat
+// before the file is accessed without following symbolic
+// links. Unlike the package-level At functions, this
+// doesn't protect against components being replaced
+// concurrently.
+func (fs FS) GetAt(dir, name string) (ACL, error) {
+	f, err := fs.resolveAt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return getType(f, aclEAAccess)
+}
+
+// GetDefaultAt retrieves the default ACL of the file
+// name, which is resolved relative to the directory dir
+// as described in the documentation for FS.GetAt.
+func (fs FS) GetDefaultAt(dir, name string) (ACL, error) {
+	f, err := fs.resolveAt(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	return getType(f, aclEADefault)
+}
+
+// SetAt sets the access ACL of the file name, which is
+// resolved relative to the directory dir as described in
+// the documentation for FS.GetAt. The ACL is set as
+// described in the documentation for Options.Set.
+func (fs FS) SetAt(dir, name string, acl ACL) error {
+	f, err := fs.resolveAt(dir, name)
+	if err != nil {
+		return err
+	}
+	return fs.setType(f, aclEAAccess, acl)
+}
+
+// SetDefaultAt sets the default ACL of the file name,
+// which is resolved relative to the directory dir as
+// described in the documentation for FS.GetAt. The ACL is
+// set as described in the documentation for
+// Options.SetDefault.
+func (fs FS) SetDefaultAt(dir, name string, acl ACL) error {
+	f, err := fs.resolveAt(dir, name)
+	if err != nil {
+		return err
+	}
+	return fs.setType(f, aclEADefault, acl)
+}
+
+// resolveAt resolves name relative to dir with the same
+// errors as openBeneath, checking each component with Lstat.
+func (fs FS) resolveAt(dir, name string) (fileObj, error) {
+	fullName := filepath.Join(dir, name)
+	switch {
+	case name == "":
+		return nil, pathError("openat", fullName, syscall.ENOENT)
+	case filepath.IsAbs(name):
+		return nil, pathError("openat", fullName, syscall.EXDEV)
+	}
+	path := dir
+	var fi os.FileInfo
+	for _, c := range strings.Split(filepath.ToSlash(name), "/") {
+		switch {
+		case c == "" || c == ".":
+			continue
+		case c == "..":
+			return nil, pathError("openat", fullName, syscall.EXDEV)
+		case fi != nil && !fi.IsDir():
+			return nil, pathError("openat", fullName, syscall.ENOTDIR)
+		}
+		path = filepath.Join(path, c)
+		var err error
+		if fi, err = fs.Backend.Lstat(path); err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil, pathError("openat", fullName, &sysError{ErrSymlink, syscall.ELOOP})
+		}
+	}
+	return fs.lfile(path), nil
+}
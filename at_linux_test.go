@@ -0,0 +1,75 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/joshlf/testutil"
+	"golang.org/x/sys/unix"
+)
+
+func TestOpenBeneathCompat(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "sub"), 0755))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(root, "sub", "file"), nil, 0644))
+	testutil.Must(t, os.Symlink("sub", filepath.Join(root, "link")))
+
+	dir, err := os.Open(root)
+	testutil.Must(t, err)
+	defer dir.Close()
+
+	for _, test := range []struct {
+		name string
+		err  error
+	}{
+		{"sub/file", nil},
+		{"./sub//file", nil},
+		{".", nil},
+		{"link", nil}, // the link itself is opened
+		{"link/file", syscall.ENOTDIR},
+		{"sub/../sub/file", syscall.EXDEV},
+		{"/etc/passwd", syscall.EXDEV},
+		{"missing", syscall.ENOENT},
+	} {
+		fd, err := openBeneathCompat(int(dir.Fd()), test.name)
+		if err != test.err {
+			t.Errorf("%v: unexpected error: want %v; got %v", test.name, test.err, err)
+		}
+		if err == nil {
+			unix.Close(fd)
+		}
+	}
+}
+
+func TestOpenBeneathEmpty(t *testing.T) {
+	dir, err := os.Open(os.TempDir())
+	testutil.Must(t, err)
+	defer dir.Close()
+
+	// force the fallback used on kernels without openat2
+	defer func(f func(int, string, *unix.OpenHow) (int, error)) { openat2 = f }(openat2)
+	for _, compat := range []bool{false, true} {
+		if compat {
+			openat2 = func(int, string, *unix.OpenHow) (int, error) { return -1, syscall.ENOSYS }
+		}
+		if fd, err := openBeneath(int(dir.Fd()), ""); err != syscall.ENOENT {
+			if err == nil {
+				unix.Close(fd)
+			}
+			t.Errorf("compat %v: unexpected error: want %v; got %v", compat, syscall.ENOENT, err)
+		}
+		if _, err := GetAt(dir, ""); !os.IsNotExist(err) {
+			t.Errorf("compat %v: unexpected error: want not-exist error; got %v", compat, err)
+		}
+	}
+}
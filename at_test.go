@@ -0,0 +1,74 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestAt(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	other := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(other)
+
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "sub"), 0755))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(root, "sub", "file"), nil, 0644))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(other, "file"), nil, 0644))
+	testutil.Must(t, os.Symlink(filepath.Join(other, "file"), filepath.Join(root, "link")))
+	testutil.Must(t, os.Symlink(other, filepath.Join(root, "dirlink")))
+
+	dir, err := os.Open(root)
+	testutil.Must(t, err)
+	defer dir.Close()
+
+	acl := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	testutil.Must(t, SetAt(dir, "sub/file", acl))
+	got, err := GetAt(dir, "sub/file")
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+	got, err = Get(filepath.Join(root, "sub", "file"))
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}
+	for _, name := range []string{"sub", "."} {
+		testutil.Must(t, SetDefaultAt(dir, name, def))
+		got, err = GetDefaultAt(dir, name)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(got, def) {
+			t.Errorf("%v: unexpected default ACL: want %v; got %v", name, def, got)
+		}
+	}
+
+	for _, name := range []string{"link", "dirlink/file", "../" + filepath.Base(other) + "/file", filepath.Join(other, "file"), "missing"} {
+		if err := SetAt(dir, name, base); err == nil {
+			t.Errorf("%v: expected error", name)
+		} else if _, ok := err.(*os.PathError); !ok {
+			t.Errorf("%v: unexpected error: want *os.PathError; got %v", name, err)
+		}
+	}
+	if _, err := GetAt(dir, "link"); !isSymlinkError(err) {
+		t.Errorf("unexpected error: want ErrSymlink; got %v", err)
+	}
+	// the targets of the symlinks must not have been modified
+	got, err = Get(filepath.Join(other, "file"))
+	testutil.Must(t, err)
+	if want := FromUnix(0644); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, got)
+	}
+}
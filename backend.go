@@ -0,0 +1,462 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"sync"
+	"syscall"
+)
+
+const (
+	// defined in include/acl_ea.h (see libacl source)
+	aclEAAccess  = "system.posix_acl_access"
+	aclEADefault = "system.posix_acl_default"
+)
+
+// A Backend provides the operations on files which are
+// needed to store and retrieve ACLs. ACLs are stored in the
+// system.posix_acl_access and system.posix_acl_default
+// extended attributes in the format of MarshalXattr.
+//
+// The methods follow the conventions of the corresponding
+// Linux system calls, returning syscall.Errno values:
+// Getxattr and Removexattr return syscall.ENODATA
+// (syscall.ENOATTR on macOS and the BSDs) if the attribute
+// doesn't exist, and Getxattr returns the size of the
+// attribute without copying it if dest is empty, or -1 and
+// syscall.ERANGE if dest is too small. The L methods don't
+// follow a symbolic link in the final component of path.
+// Like the Linux kernel, a Backend is responsible for
+// keeping the permission bits of a file's mode in sync
+// with its access ACL, and for rejecting default ACLs on
+// files which are not directories with syscall.EACCES.
+//
+// The os.FileInfo values returned by Stat, Lstat, and
+// ReadDir report the owner of a file through their Sys
+// method, either as a *FileOwner or, as os.Stat does on
+// Linux, as a *syscall.Stat_t. ReadDir returns the entries
+// of a directory sorted by name, as by Lstat. Create
+// creates an empty regular file, failing if it exists, and
+// Mkdir creates a directory; both give the new file the
+// permission bits perm, subject to the inheritance of
+// default ACLs. Chown leaves the owner or group unchanged
+// if uid or gid is -1.
+type Backend interface {
+	Getxattr(path, attr string, dest []byte) (int, error)
+	Setxattr(path, attr string, data []byte, flags int) error
+	Removexattr(path, attr string) error
+	Lgetxattr(path, attr string, dest []byte) (int, error)
+	Lsetxattr(path, attr string, data []byte, flags int) error
+	Lremovexattr(path, attr string) error
+	Stat(path string) (os.FileInfo, error)
+	Lstat(path string) (os.FileInfo, error)
+	ReadDir(path string) ([]os.FileInfo, error)
+	Create(path string, perm os.FileMode) error
+	Mkdir(path string, perm os.FileMode) error
+	Chmod(path string, mode os.FileMode) error
+	Chown(path string, uid, gid int) error
+	Remove(path string) error
+}
+
+// OSBackend is the Backend which accesses the operating
+// system's file systems. On platforms other than Linux,
+// its extended attribute methods return syscall.ENOTSUP.
+var OSBackend Backend = osBackend{}
+
+// The methods of osBackend which don't depend on the
+// platform; see acl_linux.go and acl_not_impl.go for
+// the extended attribute methods.
+
+func (osBackend) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+func (osBackend) Lstat(path string) (os.FileInfo, error) {
+	return os.Lstat(path)
+}
+
+func (osBackend) ReadDir(path string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(path)
+}
+
+func (osBackend) Create(path string, perm os.FileMode) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func (osBackend) Mkdir(path string, perm os.FileMode) error {
+	return os.Mkdir(path, perm)
+}
+
+func (osBackend) Chmod(path string, mode os.FileMode) error {
+	return os.Chmod(path, mode)
+}
+
+func (osBackend) Chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+func (osBackend) Remove(path string) error {
+	return os.Remove(path)
+}
+
+// FileOwner is the owner and group of a file. A Backend
+// may return it from the Sys method of an os.FileInfo.
+type FileOwner struct {
+	UID UID
+	GID GID
+}
+
+// fileOwner returns the UID and GID of the owner
+// of the file described by fi.
+func fileOwner(fi os.FileInfo) (uid, gid uint32, ok bool) {
+	if o, ok := fi.Sys().(*FileOwner); ok {
+		return uint32(o.UID), uint32(o.GID), true
+	}
+	return sysFileOwner(fi)
+}
+
+// backendFile is a fileObj for the file with the
+// given path in a Backend. If nofollow is true, a
+// symbolic link in the final component of the path
+// is not followed.
+type backendFile struct {
+	b        Backend
+	path     string
+	nofollow bool
+}
+
+func (f backendFile) Getxattr(attr string, dest []byte) (int, error) {
+	if f.nofollow {
+		return f.b.Lgetxattr(f.path, attr, dest)
+	}
+	return f.b.Getxattr(f.path, attr, dest)
+}
+
+func (f backendFile) Setxattr(attr string, dest []byte, flags int) error {
+	if f.nofollow {
+		return f.b.Lsetxattr(f.path, attr, dest, flags)
+	}
+	return f.b.Setxattr(f.path, attr, dest, flags)
+}
+
+func (f backendFile) Removexattr(attr string) error {
+	if f.nofollow {
+		return f.b.Lremovexattr(f.path, attr)
+	}
+	return f.b.Removexattr(f.path, attr)
+}
+
+func (f backendFile) Stat() (os.FileInfo, error) {
+	if f.nofollow {
+		return f.b.Lstat(f.path)
+	}
+	return f.b.Stat(f.path)
+}
+
+func (f backendFile) Name() string {
+	return f.path
+}
+
+// FS provides the ACL operations of this package on the
+// files of a Backend, with paths interpreted by the Backend.
+// Its methods behave like the methods of its Options field
+// of the same names where there are such methods, and like
+// the package-level functions of the same names otherwise.
+// For example, FS{Backend: OSBackend}.Get is equivalent to
+// Get, and FS{Backend: OSBackend}.Set is equivalent to
+// Options{}.Set. An FS with a MemBackend can be used to test
+// code which manipulates ACLs without a file system which
+// supports them.
+//
+// Since a Backend can't open files or create them
+// atomically, the At methods and the methods which create
+// files differ from the package-level functions as
+// described in their documentation.
+type FS struct {
+	Backend Backend
+	// Options configures the methods which modify ACLs
+	// like the methods of Options of the same names.
+	Options Options
+}
+
+func (fs FS) file(path string) fileObj {
+	return backendFile{fs.Backend, path, false}
+}
+
+func (fs FS) lfile(path string) fileObj {
+	return backendFile{fs.Backend, path, true}
+}
+
+// Get retrieves the access ACL associated with path.
+func (fs FS) Get(path string) (ACL, error) {
+	return getType(fs.file(path), aclEAAccess)
+}
+
+// GetDefault retrieves the default ACL associated with path.
+func (fs FS) GetDefault(path string) (ACL, error) {
+	return getType(fs.file(path), aclEADefault)
+}
+
+// Set sets the access ACL on path as described
+// in the documentation for Options.Set.
+func (fs FS) Set(path string, acl ACL) error {
+	return fs.setType(fs.file(path), aclEAAccess, acl)
+}
+
+// SetDefault sets the default ACL on path as
+// described in the documentation for Options.SetDefault.
+func (fs FS) SetDefault(path string, acl ACL) error {
+	return fs.setType(fs.file(path), aclEADefault, acl)
+}
+
+// LGet retrieves the access ACL associated with path
+// like Get, but doesn't follow a symbolic link in the
+// final component of path, as described in the
+// documentation for the package-level LGet.
+func (fs FS) LGet(path string) (ACL, error) {
+	return getType(fs.lfile(path), aclEAAccess)
+}
+
+// LGetDefault retrieves the default ACL associated
+// with path like GetDefault, but doesn't follow a
+// symbolic link in the final component of path.
+func (fs FS) LGetDefault(path string) (ACL, error) {
+	return getType(fs.lfile(path), aclEADefault)
+}
+
+// LSet sets the access ACL on path like Set, but doesn't
+// follow a symbolic link in the final component of path.
+func (fs FS) LSet(path string, acl ACL) error {
+	return fs.setType(fs.lfile(path), aclEAAccess, acl)
+}
+
+// LSetDefault sets the default ACL on path like
+// SetDefault, but doesn't follow a symbolic link
+// in the final component of path.
+func (fs FS) LSetDefault(path string, acl ACL) error {
+	return fs.setType(fs.lfile(path), aclEADefault, acl)
+}
+
+func (fs FS) setType(f fileObj, attr string, acl ACL) error {
+	acl, err := fs.Options.resolve(acl, f.Stat)
+	if err != nil {
+		return err
+	}
+	acl = fs.Options.withMask(acl)
+	if err := acl.Validate(); err != nil {
+		return pathError(opName("set", attr), f.Name(), err)
+	}
+	return setType(f, attr, acl)
+}
+
+// Add adds the given entries to the ACL on path as
+// described in the documentation for Options.Add.
+func (fs FS) Add(path string, entries ...Entry) error {
+	f := fs.file(path)
+	oldACL, err := getType(f, aclEAAccess)
+	if err != nil {
+		return err
+	}
+	resolved, err := fs.Options.resolve(entries, f.Stat)
+	if err != nil {
+		return err
+	}
+	newACL, err := add(oldACL, !fs.Options.NoMaskRecalc, resolved...)
+	if err != nil {
+		return pathError("add", f.Name(), err)
+	}
+	return setType(f, aclEAAccess, newACL)
+}
+
+// Remove removes the entries matching the given keys from
+// the ACL on path as described in the documentation for
+// Options.Remove.
+func (fs FS) Remove(path string, keys ...Key) error {
+	f := fs.file(path)
+	oldACL, err := getType(f, aclEAAccess)
+	if err != nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !fs.Options.NoMaskRecalc, fs.Options.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", f.Name(), err)
+	}
+	return setType(f, aclEAAccess, newACL)
+}
+
+// RemoveFromDefault removes entries from the default ACL
+// on path like Remove. If path has no default ACL, it
+// does nothing.
+func (fs FS) RemoveFromDefault(path string, keys ...Key) error {
+	f := fs.file(path)
+	oldACL, err := getType(f, aclEADefault)
+	if err != nil || oldACL == nil {
+		return err
+	}
+	newACL, err := remove(oldACL, !fs.Options.NoMaskRecalc, fs.Options.Resolver, keys...)
+	if err != nil {
+		return pathError("remove", f.Name(), err)
+	}
+	return setType(f, aclEADefault, newACL)
+}
+
+// RemoveExtended removes all named user and group entries
+// and the mask entry from the access ACL on path.
+func (fs FS) RemoveExtended(path string) error {
+	f := fs.file(path)
+	oldACL, err := getType(f, aclEAAccess)
+	if err != nil {
+		return err
+	}
+	return setType(f, aclEAAccess, oldACL.minimal())
+}
+
+// RemoveDefault removes the default ACL from path.
+func (fs FS) RemoveDefault(path string) error {
+	return removeType(fs.file(path), aclEADefault)
+}
+
+// Chmod changes the permissions of the access
+// ACL on path as described by ACL.Chmod.
+func (fs FS) Chmod(path string, mode os.FileMode) error {
+	f := fs.file(path)
+	acl, err := getType(f, aclEAAccess)
+	if err != nil {
+		return err
+	}
+	return setType(f, aclEAAccess, acl.Chmod(mode))
+}
+
+const defaultbuflen = 64
+
+type fileObj interface {
+	Getxattr(attr string, dest []byte) (int, error)
+	Setxattr(attr string, dest []byte, flags int) error
+	Removexattr(attr string) error
+	Stat() (os.FileInfo, error)
+	Name() string
+}
+
+// based on libacl's acl_get_file
+func getType(f fileObj, attr string) (ACL, error) {
+	acl, err := getTypeErr(f, attr)
+	return acl, pathError(opName("get", attr), f.Name(), err)
+}
+
+func getTypeErr(f fileObj, attr string) (ACL, error) {
+	buf := bufpool.Get().([]byte)
+	defer func() { bufpool.Put(buf) }()
+
+	sz, err := f.Getxattr(attr, buf)
+	if sz == -1 && err == syscall.ERANGE {
+		sz, err = f.Getxattr(attr, nil)
+		if sz <= 0 {
+			return nil, err
+		}
+		buf = make([]byte, sz)
+		sz, err = f.Getxattr(attr, buf)
+	}
+
+	switch {
+	case sz > 0:
+		return UnmarshalXattr(buf[:sz])
+	case err == errNoData:
+		fi, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return nil, &sysError{ErrSymlink, syscall.EOPNOTSUPP}
+		}
+		if attr == aclEADefault {
+			if fi.IsDir() {
+				return nil, nil
+			}
+			return nil, &sysError{ErrNotDirectory, syscall.EACCES}
+		} else {
+			return FromUnix(fi.Mode()), nil
+		}
+	default:
+		return nil, symlinkError(f, err)
+	}
+}
+
+// based on libacl's acl_set_file
+func setType(f fileObj, attr string, acl ACL) error {
+	return pathError(opName("set", attr), f.Name(), setTypeErr(f, attr, acl))
+}
+
+func setTypeErr(f fileObj, attr string, acl ACL) error {
+	if attr == aclEADefault {
+		fi, err := f.Stat()
+		if err != nil {
+			return err
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return &sysError{ErrSymlink, syscall.EOPNOTSUPP}
+		}
+		// non-directories can't have default ACLs
+		if !fi.IsDir() {
+			return &sysError{ErrNotDirectory, syscall.EACCES}
+		}
+	}
+
+	xattr, err := MarshalXattr(acl)
+	if err != nil {
+		return err
+	}
+	err = f.Setxattr(attr, xattr, 0)
+	if err == syscall.EINVAL {
+		// the kernel rejected the xattr
+		return &sysError{ErrMalformedXattr, err}
+	}
+	return symlinkError(f, err)
+}
+
+// based on libacl's acl_delete_def_file
+func removeType(f fileObj, attr string) error {
+	err := f.Removexattr(attr)
+	if err == errNoData {
+		// there was nothing to remove
+		return nil
+	}
+	return pathError(opName("remove", attr), f.Name(), symlinkError(f, err))
+}
+
+// symlinkError returns an error matching ErrSymlink if err
+// was caused by f being a symbolic link, and err otherwise.
+// Only an lpath can refer to a symbolic link.
+func symlinkError(f fileObj, err error) error {
+	if err != syscall.EOPNOTSUPP {
+		return err
+	}
+	fi, serr := f.Stat()
+	if serr != nil || fi.Mode()&os.ModeSymlink == 0 {
+		return err
+	}
+	return &sysError{ErrSymlink, err}
+}
+
+// opName returns the name of the operation verb
+// on the ACL stored in attr for use in errors.
+func opName(verb, attr string) string {
+	if attr == aclEADefault {
+		return verb + "default"
+	}
+	return verb
+}
+
+var bufpool = sync.Pool{
+	New: func() interface{} { return make([]byte, defaultbuflen) },
+}
@@ -0,0 +1,112 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import "os"
+
+// CreateWithACL creates the named file with the access
+// ACL acl and opens it for reading and writing. Unlike
+// os.Create, it fails if the file already exists.
+//
+// The ACL is in place before the file becomes visible,
+// so no other process can observe it with permissions
+// other than acl. On Linux, the file is created with
+// O_TMPFILE, has its ACL set, and is then linked into
+// place. If the kernel or filesystem doesn't support
+// O_TMPFILE, the file is instead created with no
+// permissions and then has its ACL set.
+func CreateWithACL(name string, acl ACL) (*os.File, error) {
+	if err := acl.Validate(); err != nil {
+		return nil, pathError("create", name, err)
+	}
+	return create(name, acl)
+}
+
+// MkdirWithACL creates the named directory with the
+// access ACL access and the default ACL def. If def is
+// nil, the directory has no default ACL, even if its
+// parent has one. It fails if name already exists.
+//
+// The ACLs are in place before the directory becomes
+// visible, so no other process can observe it with
+// permissions other than access. On Linux, the directory
+// is created under a temporary name in the same parent
+// directory, has its ACLs set, and is then renamed into
+// place with RENAME_NOREPLACE. If the kernel or filesystem
+// doesn't support RENAME_NOREPLACE, the directory is
+// instead created with no permissions and then has its
+// ACLs set.
+func MkdirWithACL(name string, access, def ACL) error {
+	if err := access.Validate(); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	if def != nil {
+		if err := def.Validate(); err != nil {
+			return pathError("mkdir", name, err)
+		}
+	}
+	return mkdir(name, access, def)
+}
+
+// CreateWithACL creates the named empty file with the
+// access ACL acl like the package-level CreateWithACL, but
+// doesn't open it. Since a Backend can't create a file with
+// its ACL in place, the file is created with no permissions
+// and then has its ACL set, so that it is never accessible
+// with permissions other than acl. If the ACL can't be set,
+// the file is removed.
+func (fs FS) CreateWithACL(name string, acl ACL) error {
+	if err := acl.Validate(); err != nil {
+		return pathError("create", name, err)
+	}
+	if err := fs.Backend.Create(name, 0); err != nil {
+		return err
+	}
+	if err := setType(fs.file(name), aclEAAccess, acl); err != nil {
+		fs.Backend.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// MkdirWithACL creates the named directory with the access
+// ACL access and the default ACL def like the package-level
+// MkdirWithACL. As described in the documentation for
+// FS.CreateWithACL, the directory is created with no
+// permissions and then has its ACLs set.
+func (fs FS) MkdirWithACL(name string, access, def ACL) error {
+	if err := access.Validate(); err != nil {
+		return pathError("mkdir", name, err)
+	}
+	if def != nil {
+		if err := def.Validate(); err != nil {
+			return pathError("mkdir", name, err)
+		}
+	}
+	if err := fs.Backend.Mkdir(name, 0); err != nil {
+		return err
+	}
+	if err := fs.setDirACLs(name, access, def); err != nil {
+		fs.Backend.Remove(name)
+		return err
+	}
+	return nil
+}
+
+// setDirACLs sets the ACLs of the directory path, which
+// have already been validated, removing any inherited
+// default ACL if def is nil.
+func (fs FS) setDirACLs(path string, access, def ACL) error {
+	if def == nil {
+		if err := removeType(fs.file(path), aclEADefault); err != nil {
+			return err
+		}
+	} else if err := setType(fs.file(path), aclEADefault, def); err != nil {
+		return err
+	}
+	return setType(fs.file(path), aclEAAccess, access)
+}
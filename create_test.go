@@ -0,0 +1,88 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestCreateWithACL(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	// the new file's ACL should replace the one it inherits
+	testutil.Must(t, SetDefault(d, ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 7}, {TagOther, "", 7}}))
+
+	acl := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	name := filepath.Join(d, "file")
+	f, err := CreateWithACL(name, acl)
+	testutil.Must(t, err)
+	defer f.Close()
+	if f.Name() != name {
+		t.Errorf("unexpected file name: want %v; got %v", name, f.Name())
+	}
+	if _, err := f.Write([]byte("foo")); err != nil {
+		t.Errorf("unexpected error writing file: %v", err)
+	}
+	got, err := Get(name)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+
+	if _, err := CreateWithACL(name, acl); !os.IsExist(err) {
+		t.Errorf("unexpected error creating existing file: %v", err)
+	}
+	if _, err := CreateWithACL(filepath.Join(d, "invalid"), ACL{}); err == nil {
+		t.Errorf("expected error creating file with invalid ACL")
+	}
+	if _, err := os.Stat(filepath.Join(d, "invalid")); !os.IsNotExist(err) {
+		t.Errorf("file created despite invalid ACL: %v", err)
+	}
+}
+
+func TestMkdirWithACL(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	testutil.Must(t, SetDefault(d, ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 7}, {TagOther, "", 7}}))
+
+	access := ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 5}, {TagMask, "", 5}, {TagOther, "", 0}}
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagOther, "", 0}}
+	for _, def := range []ACL{def, nil} {
+		name := filepath.Join(d, "dir")
+		testutil.Must(t, MkdirWithACL(name, access, def))
+		got, err := Get(name)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(got, access) {
+			t.Errorf("unexpected access ACL: want %v; got %v", access, got)
+		}
+		gotDef, err := GetDefault(name)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(gotDef, def) {
+			t.Errorf("unexpected default ACL: want %v; got %v", def, gotDef)
+		}
+
+		if err := MkdirWithACL(name, access, def); !os.IsExist(err) {
+			t.Errorf("unexpected error creating existing directory: %v", err)
+		}
+		testutil.Must(t, os.Remove(name))
+	}
+
+	// no temporary directories should be left behind
+	f, err := os.Open(d)
+	testutil.Must(t, err)
+	names, err := f.Readdirnames(-1)
+	f.Close()
+	testutil.Must(t, err)
+	if len(names) != 0 {
+		t.Errorf("unexpected files left in directory: %v", names)
+	}
+}
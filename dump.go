@@ -0,0 +1,272 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// DumpOptions configures the behavior of Dump.
+type DumpOptions struct {
+	// If AbsoluteNames is true, leading slashes are not
+	// stripped from paths (like getfacl --absolute-names).
+	AbsoluteNames bool
+
+	// If Numeric is true, user and group IDs are printed
+	// instead of names (like getfacl -n). This is equivalent
+	// to setting Resolver to NumericResolver.
+	Numeric bool
+
+	// Resolver is used to look up user and group names.
+	// If it is nil, the system's user and group database
+	// is used.
+	Resolver Resolver
+}
+
+// Dump walks the file tree rooted at root and writes the
+// ACLs of every file to w in the format produced by
+// getfacl -R, which can be read back with Decoder and
+// Restore or with setfacl --restore. Directories are
+// visited in lexical order. If root is a symbolic link, it
+// is followed; other symbolic links are not. opts may be
+// nil, in which case the defaults are used.
+//
+// If the ACLs of a file cannot be retrieved, it is skipped
+// and Dump continues with the remaining files. If any such
+// errors occur, Dump returns a MultiError containing an
+// *os.PathError for each of them. An error writing to w
+// stops the walk and is returned directly.
+func Dump(w io.Writer, root string, opts *DumpOptions) error {
+	return FS{Backend: OSBackend}.Dump(w, root, opts)
+}
+
+// Dump writes the ACLs of root and the files
+// beneath it to w like the package-level Dump.
+func (fs FS) Dump(w io.Writer, root string, opts *DumpOptions) error {
+	if opts == nil {
+		opts = &DumpOptions{}
+	}
+	r := opts.Resolver
+	switch {
+	case opts.Numeric:
+		r = NumericResolver{}
+	case r == nil:
+		r = defaultResolver
+	}
+
+	var errs MultiError
+	var werr error
+	visit := func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+			// like getfacl, skip symlinks below the root
+			return nil
+		}
+		if err == nil {
+			var fa *FileACL
+			fa, err = fs.getFileACL(path, fi, r)
+			if err == nil {
+				if !opts.AbsoluteNames {
+					fa.Path = strings.TrimLeft(fa.Path, "/")
+					if fa.Path == "" {
+						fa.Path = "."
+					}
+				}
+				_, werr = io.WriteString(w, fa.format(r)+"\n")
+				return werr
+			}
+		}
+		if pe, ok := err.(*os.PathError); ok {
+			errs = append(errs, pe)
+		} else {
+			errs = append(errs, &os.PathError{Op: "dump", Path: path, Err: err})
+		}
+		if fi != nil && fi.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	}
+
+	// unlike the rest of the walk, getfacl
+	// follows a symlink at the root
+	fi, err := fs.Backend.Stat(root)
+	if err != nil {
+		err = visit(root, nil, err)
+	} else {
+		err = walkTree(fs.Backend, root, fi, visit)
+	}
+	if werr != nil {
+		return werr
+	}
+	if err != nil && err != filepath.SkipDir {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// walkTree walks the tree of b rooted at path, which is
+// described by fi, like filepath.Walk. Unlike filepath.Walk,
+// it keeps path as given rather than cleaning it, as getfacl
+// does, so that a root of "." gives "./a" rather than "a".
+func walkTree(b Backend, path string, fi os.FileInfo, fn filepath.WalkFunc) error {
+	if err := fn(path, fi, nil); err != nil || !fi.IsDir() {
+		return err
+	}
+	infos, err := b.ReadDir(path)
+	if err != nil {
+		return fn(path, fi, err)
+	}
+	prefix := strings.TrimRight(path, string(filepath.Separator)) + string(filepath.Separator)
+	for _, cfi := range infos {
+		err := walkTree(b, prefix+cfi.Name(), cfi, fn)
+		if err != nil && (err != filepath.SkipDir || !cfi.IsDir()) {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetFileACL retrieves the access ACL and (for directories)
+// the default ACL associated with path, along with the
+// metadata which getfacl prints in the comment header
+// of the long text form, returning any error encountered.
+func GetFileACL(path string) (*FileACL, error) {
+	return FS{Backend: OSBackend}.GetFileACL(path)
+}
+
+// GetFileACL retrieves the ACLs and metadata of
+// path like the package-level GetFileACL.
+func (fs FS) GetFileACL(path string) (*FileACL, error) {
+	fi, err := fs.Backend.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	return fs.getFileACL(path, fi, defaultResolver)
+}
+
+func (fs FS) getFileACL(path string, fi os.FileInfo, r Resolver) (*FileACL, error) {
+	fa := &FileACL{
+		Path:  path,
+		Flags: fi.Mode() & (os.ModeSetuid | os.ModeSetgid | os.ModeSticky),
+	}
+	if uid, gid, ok := fileOwner(fi); ok {
+		fa.Owner = formatQualifier(r, strconv.FormatUint(uint64(uid), 10), TagUser)
+		fa.Group = formatQualifier(r, strconv.FormatUint(uint64(gid), 10), TagGroup)
+	}
+	var err error
+	if fa.Access, err = fs.Get(path); err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		if fa.Default, err = fs.GetDefault(path); err != nil {
+			return nil, err
+		}
+	}
+	return fa, nil
+}
+
+// String returns the ACLs of fa in the long text form,
+// preceded by the comment header, exactly as printed by
+// getfacl. Each line, including the last, is terminated
+// by a newline. Paths and names are escaped as in getfacl,
+// and the "# owner:", "# group:", and "# flags:" headers
+// are omitted if the corresponding fields are empty.
+func (fa *FileACL) String() string {
+	return fa.format(defaultResolver)
+}
+
+// StringWith is like String, but uses r to look
+// up the names of users and groups in entries.
+func (fa *FileACL) StringWith(r Resolver) string {
+	return fa.format(r)
+}
+
+func (fa *FileACL) format(r Resolver) string {
+	var buf bytes.Buffer
+	if fa.Path != "" {
+		fmt.Fprintf(&buf, "# file: %s\n", quote(fa.Path, quotePath))
+	}
+	if fa.Owner != "" {
+		fmt.Fprintf(&buf, "# owner: %s\n", quote(fa.Owner, quoteOwner))
+	}
+	if fa.Group != "" {
+		fmt.Fprintf(&buf, "# group: %s\n", quote(fa.Group, quoteOwner))
+	}
+	if fa.Flags != 0 {
+		flags := []byte("---")
+		if fa.Flags&os.ModeSetuid != 0 {
+			flags[0] = 's'
+		}
+		if fa.Flags&os.ModeSetgid != 0 {
+			flags[1] = 's'
+		}
+		if fa.Flags&os.ModeSticky != 0 {
+			flags[2] = 't'
+		}
+		fmt.Fprintf(&buf, "# flags: %s\n", flags)
+	}
+	writeGetfaclEntries(&buf, fa.Access, "", r)
+	writeGetfaclEntries(&buf, fa.Default, "default:", r)
+	return buf.String()
+}
+
+// writeGetfaclEntries writes the entries of a in the long
+// text form, one per line, with each line prefixed by prefix.
+// Unlike StringLong, #effective comments are aligned with
+// tabs as in getfacl.
+func writeGetfaclEntries(buf *bytes.Buffer, a ACL, prefix string, r Resolver) {
+	effective := a.EffectivePerms()
+	for i, e := range a {
+		line := prefix + e.format(e.Tag.StringLong(), r)
+		buf.WriteString(line)
+		if effective[i] != e.perms() {
+			// align the comment to the fifth tab stop
+			tabs := 4 - len(line)/8
+			if tabs < 1 {
+				tabs = 1
+			}
+			buf.WriteString(strings.Repeat("\t", tabs))
+			buf.WriteString("#effective:" + permString(effective[i]))
+		}
+		buf.WriteByte('\n')
+	}
+}
+
+// The characters which getfacl escapes in addition to
+// backslashes, in file names, in the "# owner:" and
+// "# group:" headers, and in the names in entries.
+const (
+	quotePath  = "\n\r"
+	quoteOwner = " \t\n\r"
+	quoteEntry = ":, \t\n\r"
+)
+
+// quote escapes backslashes and the characters in special
+// using octal escape sequences, as getfacl does. It is the
+// inverse of unquote.
+func quote(s, special string) string {
+	if strings.IndexAny(s, "\\"+special) == -1 {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c == '\\' || strings.IndexByte(special, c) != -1 {
+			fmt.Fprintf(&buf, "\\%03o", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,134 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestDump(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	testutil.Must(t, os.Chmod(d, 0755|os.ModeSetgid))
+	testutil.Must(t, SetDefault(d, ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}))
+	f := filepath.Join(d, "a\\b")
+	testutil.Must(t, ioutil.WriteFile(f, nil, 0600))
+	facl := ACL{{TagUserObj, "", 6}, {TagUser, "0", 7}, {TagGroupObj, "", 6},
+		{TagMask, "", 4}, {TagOther, "", 0}}
+	testutil.Must(t, Set(f, facl))
+	testutil.Must(t, os.Symlink("a\\b", filepath.Join(d, "link")))
+
+	var buf bytes.Buffer
+	testutil.Must(t, Dump(&buf, d, &DumpOptions{Numeric: true}))
+
+	owner := fmt.Sprintf("# owner: %d\n# group: %d\n", os.Getuid(), os.Getgid())
+	want := "# file: " + strings.TrimLeft(d, "/") + "\n" + owner +
+		"# flags: -s-\n" +
+		"user::rwx\n" +
+		"group::r-x\n" +
+		"other::r-x\n" +
+		"default:user::rwx\n" +
+		"default:group::r-x\n" +
+		"default:other::---\n" +
+		"\n" +
+		"# file: " + strings.TrimLeft(d, "/") + "/a\\134b\n" + owner +
+		"user::rw-\n" +
+		"user:0:rwx\t\t\t#effective:r--\n" +
+		"group::rw-\t\t\t#effective:r--\n" +
+		"mask::r--\n" +
+		"other::---\n" +
+		"\n"
+	if buf.String() != want {
+		t.Errorf("unexpected output:\nwant:\n%s\ngot:\n%s", want, buf.String())
+	}
+
+	// Make sure the output can be restored
+	testutil.Must(t, Set(f, FromUnix(0600)))
+	testutil.Must(t, Restore(&buf, &RestoreOptions{Dir: "/"}))
+	acl, err := Get(f)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(acl, facl) {
+		t.Errorf("unexpected ACL after restore: want %v; got %v", facl, acl)
+	}
+}
+
+func TestDumpRelativeRoot(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	testutil.Must(t, os.Mkdir(filepath.Join(d, "dir"), 0755))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(d, "dir", "a"), nil, 0600))
+	wd, err := os.Getwd()
+	testutil.Must(t, err)
+	testutil.Must(t, os.Chdir(d))
+	defer os.Chdir(wd)
+
+	// like getfacl -R, keep the root as given
+	for _, c := range []struct {
+		root  string
+		files []string
+	}{
+		{".", []string{".", "./dir", "./dir/a"}},
+		{"./dir/", []string{"./dir/", "./dir/a"}},
+		{"dir", []string{"dir", "dir/a"}},
+	} {
+		var buf bytes.Buffer
+		testutil.Must(t, Dump(&buf, c.root, &DumpOptions{Numeric: true}))
+		var files []string
+		for _, line := range strings.Split(buf.String(), "\n") {
+			if strings.HasPrefix(line, "# file: ") {
+				files = append(files, line[len("# file: "):])
+			}
+		}
+		if !reflect.DeepEqual(files, c.files) {
+			t.Errorf("%v: unexpected files: want %q; got %q", c.root, c.files, files)
+		}
+	}
+}
+
+func TestFileACLStringEscapes(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "etc"), 0755))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(root, "etc", "group"), []byte("domain users:x:3000:\nweird,name:x:3001:\n"), 0644))
+	r := NewFileResolver(root)
+
+	fa := &FileACL{
+		Path:  "some file",
+		Owner: "jdoe",
+		Group: "domain users",
+		Access: ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagGroup, "3000", 7},
+			{TagGroup, "3001", 4}, {TagMask, "", 7}, {TagOther, "", 4}},
+	}
+	want := `# file: some file
+# owner: jdoe
+# group: domain\040users
+user::rw-
+group::r--
+group:domain\040users:rwx
+group:weird\054name:r--
+mask::rwx
+other::r--
+`
+	text := fa.StringWith(r)
+	if text != want {
+		t.Errorf("unexpected output:\nwant:\n%s\ngot:\n%s", want, text)
+	}
+	fa2, err := ParseLongWith(text, r)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(fa2, fa) {
+		t.Errorf("unexpected result after round trip: want %+v; got %+v", fa, fa2)
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+var (
+	// ErrNotSupported indicates that ACLs are not supported
+	// by the platform or by the file system.
+	ErrNotSupported = errors.New("ACLs not supported")
+	// ErrNotDirectory indicates an attempt to get or set
+	// the default ACL of a file which is not a directory.
+	ErrNotDirectory = errors.New("default ACLs are only supported on directories")
+	// ErrMalformedXattr indicates that an extended attribute
+	// holding an ACL could not be decoded, or that the kernel
+	// rejected one as malformed.
+	ErrMalformedXattr = errors.New("malformed ACL extended attribute")
+	// ErrSymlink indicates an attempt to get or set the ACL
+	// of a symbolic link itself (see LGet and LSet). Linux
+	// doesn't support ACLs on symbolic links.
+	ErrSymlink = errors.New("symbolic links cannot have ACLs")
+)
+
+// sysError is a system error which corresponds to one of
+// the sentinel errors. With errors.Is, it matches both the
+// sentinel error and the system error, so callers which
+// compare against errno values keep working.
+type sysError struct {
+	sentinel error
+	err      error
+}
+
+func (e *sysError) Error() string {
+	return e.sentinel.Error() + ": " + e.err.Error()
+}
+
+func (e *sysError) Is(target error) bool { return target == e.sentinel }
+func (e *sysError) Unwrap() error        { return e.err }
+
+// causeError is an error with its own message which
+// otherwise behaves like the system error err.
+type causeError struct {
+	msg string
+	err error
+}
+
+func (e *causeError) Error() string { return e.msg }
+func (e *causeError) Unwrap() error { return e.err }
+
+// pathError wraps err, which was returned by the operation
+// op on path, in an *os.PathError, associating it with the
+// matching sentinel error if there is one. err is returned
+// unchanged if it is nil or already an *os.PathError.
+func pathError(op, path string, err error) error {
+	switch err.(type) {
+	case nil, *os.PathError:
+		return err
+	}
+	if err == syscall.ENOTSUP || err == syscall.EOPNOTSUPP {
+		err = &sysError{ErrNotSupported, err}
+	}
+	return &os.PathError{Op: op, Path: path, Err: err}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build go1.13
+
+package acl
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestErrors(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	file := testutil.MustTempFile(t, d, "acl")
+	file.Close()
+	f := file.Name()
+
+	checkPathError := func(err error, op, path string, targets ...error) {
+		pe, ok := err.(*os.PathError)
+		if !ok {
+			t.Errorf("unexpected error: want *os.PathError; got %v", err)
+			return
+		}
+		if pe.Op != op || pe.Path != path {
+			t.Errorf("unexpected operation and path: want %v %v; got %v %v", op, path, pe.Op, pe.Path)
+		}
+		for _, target := range targets {
+			if !errors.Is(err, target) {
+				t.Errorf("expected %v to match %v", err, target)
+			}
+		}
+	}
+
+	_, err := Get(filepath.Join(d, "missing"))
+	checkPathError(err, "get", filepath.Join(d, "missing"), os.ErrNotExist)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected os.IsNotExist(%v)", err)
+	}
+
+	_, err = GetDefault(f)
+	checkPathError(err, "getdefault", f, ErrNotDirectory, syscall.EACCES)
+	err = SetDefault(f, base)
+	checkPathError(err, "setdefault", f, ErrNotDirectory, syscall.EACCES)
+
+	err = pathError("set", f, syscall.ENOTSUP)
+	checkPathError(err, "set", f, ErrNotSupported, syscall.ENOTSUP)
+	if errors.Is(err, ErrNotDirectory) {
+		t.Errorf("unexpected match of %v with ErrNotDirectory", err)
+	}
+	// errors which are already *os.PathErrors are not wrapped again
+	if err2 := pathError("add", f, err); err2 != err {
+		t.Errorf("unexpected error: want %v; got %v", err, err2)
+	}
+
+	err = Set(f, ACL{{TagUserObj, "", 7}, {TagOther, "", 0}})
+	checkPathError(err, "set", f)
+	var verr *ValidationError
+	if !errors.As(err, &verr) || len(verr.Violations) != 1 {
+		t.Errorf("expected %v to match a *ValidationError", err)
+	}
+
+	_, err = UnmarshalXattr([]byte{1})
+	if !errors.Is(err, ErrMalformedXattr) || !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("expected %v to match ErrMalformedXattr and syscall.EINVAL", err)
+	}
+	_, err = MarshalXattr(ACL{{TagUser, "nonexistent-user", 7}})
+	if !errors.Is(err, syscall.EINVAL) {
+		t.Errorf("expected %v to match syscall.EINVAL", err)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import "os"
+
+// Inherit predicts the ACLs which a new file or directory
+// receives when it is created in a directory whose default
+// ACL is parentDefault (as returned by GetDefault), following
+// the semantics of the Linux kernel's posix_acl_create. mode
+// is the mode passed to open or mkdir (for example, by
+// os.OpenFile or os.Mkdir), and isDir is whether the new
+// object is a directory.
+//
+// If parentDefault is not nil, the access ACL is a copy of
+// parentDefault in which the permissions of the TagUserObj
+// and TagOther entries, and of the mask entry (or, if there
+// is none, the TagGroupObj entry), are limited by the
+// corresponding bits of mode. The umask is not applied in
+// this case. If the new object is a directory, it also
+// inherits parentDefault as its default ACL.
+//
+// If parentDefault is nil, the access ACL is the ACL
+// equivalent to mode and the default ACL is nil. In this
+// case, the kernel also applies the umask of the creating
+// process, which the caller must clear from mode.
+func Inherit(parentDefault ACL, mode os.FileMode, isDir bool) (access, def ACL) {
+	if parentDefault == nil {
+		return FromUnix(mode), nil
+	}
+
+	access = append(ACL(nil), parentDefault...)
+	groupObj, mask := -1, -1
+	for i := range access {
+		e := &access[i]
+		switch e.Tag {
+		case TagUserObj:
+			e.Perms = e.perms() & (mode >> 6) & 7
+		case TagOther:
+			e.Perms = e.perms() & mode & 7
+		case TagGroupObj:
+			groupObj = i
+		case TagMask:
+			mask = i
+		}
+	}
+	switch {
+	case mask != -1:
+		access[mask].Perms = access[mask].perms() & (mode >> 3) & 7
+	case groupObj != -1:
+		access[groupObj].Perms = access[groupObj].perms() & (mode >> 3) & 7
+	}
+
+	if isDir {
+		def = append(ACL(nil), parentDefault...)
+	}
+	return access, def
+}
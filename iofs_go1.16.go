@@ -0,0 +1,133 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build go1.16
+
+package acl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// ACLFS is a file system which stores the ACLs of its
+// files. It is an optional interface for an fs.FS in the
+// style of fs.StatFS; see ReadACL and ReadDefaultACL.
+type ACLFS interface {
+	fs.FS
+
+	// ReadACL returns the access ACL of the named file.
+	ReadACL(name string) (ACL, error)
+
+	// ReadDefaultACL returns the default ACL of the named
+	// directory, or nil if it has none. If the file is not
+	// a directory, the error matches ErrNotDirectory.
+	ReadDefaultACL(name string) (ACL, error)
+}
+
+// ReadACL returns the access ACL of the named file in fsys.
+// If fsys implements ACLFS, ReadACL calls fsys.ReadACL.
+// Otherwise, if the Sys method of the file's fs.FileInfo
+// returns a *FileACL with a non-nil Access ACL, ReadACL
+// returns a copy of it, and if not, it returns an ACL
+// computed from the file's mode with FromUnix. This allows
+// ACLs to be attached to the files of an fstest.MapFS
+// through the Sys field of fstest.MapFile.
+func ReadACL(fsys fs.FS, name string) (ACL, error) {
+	if fsys, ok := fsys.(ACLFS); ok {
+		return fsys.ReadACL(name)
+	}
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if fa, ok := fi.Sys().(*FileACL); ok && fa.Access != nil {
+		return append(ACL(nil), fa.Access...), nil
+	}
+	return FromUnix(fi.Mode()), nil
+}
+
+// ReadDefaultACL returns the default ACL of the named
+// directory in fsys, or nil if it has none. If fsys
+// implements ACLFS, ReadDefaultACL calls
+// fsys.ReadDefaultACL. Otherwise, it returns a copy of the
+// Default ACL of the file's *FileACL as described for
+// ReadACL, or nil if it has none. If the file is not a
+// directory, the error matches ErrNotDirectory.
+func ReadDefaultACL(fsys fs.FS, name string) (ACL, error) {
+	if fsys, ok := fsys.(ACLFS); ok {
+		return fsys.ReadDefaultACL(name)
+	}
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, pathError("readdefaultacl", name, &sysError{ErrNotDirectory, syscall.EACCES})
+	}
+	if fa, ok := fi.Sys().(*FileACL); ok && fa.Default != nil {
+		return append(ACL(nil), fa.Default...), nil
+	}
+	return nil, nil
+}
+
+// DirFS returns a file system for the tree of files rooted
+// at the directory dir, like os.DirFS, which implements
+// ACLFS using Get and GetDefault. As with os.DirFS,
+// symbolic links within the tree are followed, even if
+// they point outside of it, and all operations fail if dir
+// is empty.
+func DirFS(dir string) ACLFS {
+	return dirFS{os.DirFS(dir), dir}
+}
+
+// dirFS embeds the os.DirFS for dir, and forwards Stat,
+// ReadFile, and ReadDir to it so that its implementations
+// of them are used where it has them.
+type dirFS struct {
+	fs.FS
+	dir string
+}
+
+func (d dirFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(d.FS, name)
+}
+
+func (d dirFS) ReadFile(name string) ([]byte, error) {
+	return fs.ReadFile(d.FS, name)
+}
+
+func (d dirFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return fs.ReadDir(d.FS, name)
+}
+
+func (d dirFS) ReadACL(name string) (ACL, error) {
+	return d.read("readacl", name, Get)
+}
+
+func (d dirFS) ReadDefaultACL(name string) (ACL, error) {
+	return d.read("readdefaultacl", name, GetDefault)
+}
+
+func (d dirFS) read(op, name string, get func(path string) (ACL, error)) (ACL, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if d.dir == "" {
+		// like os.DirFS, rather than resolving
+		// name relative to the working directory
+		return nil, &fs.PathError{Op: op, Path: name, Err: errors.New("acl: DirFS with empty root")}
+	}
+	acl, err := get(filepath.Join(d.dir, filepath.FromSlash(name)))
+	if err, ok := err.(*os.PathError); ok {
+		// like os.DirFS, report the path relative to dir
+		err.Path = name
+	}
+	return acl, err
+}
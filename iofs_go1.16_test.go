@@ -0,0 +1,115 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build go1.16
+
+package acl
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestReadACLMapFS(t *testing.T) {
+	access := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}
+	fsys := fstest.MapFS{
+		"plain":    {Mode: 0640},
+		"file":     {Mode: 0640, Sys: &FileACL{Access: access}},
+		"dir":      {Mode: fs.ModeDir | 0750, Sys: &FileACL{Default: def}},
+		"dir/file": {Mode: 0600},
+	}
+
+	for _, c := range []struct {
+		name          string
+		access, deflt ACL
+	}{
+		{"plain", FromUnix(0640), nil},
+		{"file", access, nil},
+		{"dir", FromUnix(0750), def},
+		{"dir/file", FromUnix(0600), nil},
+	} {
+		got, err := ReadACL(fsys, c.name)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(got, c.access) {
+			t.Errorf("%v: unexpected access ACL: want %v; got %v", c.name, c.access, got)
+		}
+		if c.name != "dir" {
+			continue
+		}
+		got, err = ReadDefaultACL(fsys, c.name)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(got, c.deflt) {
+			t.Errorf("%v: unexpected default ACL: want %v; got %v", c.name, c.deflt, got)
+		}
+	}
+
+	_, err := ReadDefaultACL(fsys, "file")
+	if !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("unexpected error reading default ACL of file: %v", err)
+	}
+	if _, err := ReadACL(fsys, "missing"); !os.IsNotExist(err) {
+		t.Errorf("unexpected error reading ACL of missing file: %v", err)
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	access := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}
+	testutil.Must(t, os.Mkdir(filepath.Join(d, "dir"), 0755))
+	testutil.Must(t, SetDefault(filepath.Join(d, "dir"), def))
+	f := testutil.MustTempFile(t, d, "acl")
+	f.Close()
+	testutil.Must(t, Set(f.Name(), access))
+	name := filepath.Base(f.Name())
+
+	fsys := DirFS(d)
+	testutil.Must(t, fstest.TestFS(fsys, "dir", name))
+	got, err := ReadACL(fsys, name)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, access) {
+		t.Errorf("unexpected access ACL: want %v; got %v", access, got)
+	}
+	got, err = ReadDefaultACL(fsys, "dir")
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, def) {
+		t.Errorf("unexpected default ACL: want %v; got %v", def, got)
+	}
+	got, err = ReadDefaultACL(fsys, ".")
+	testutil.Must(t, err)
+	if got != nil {
+		t.Errorf("unexpected default ACL: want nil; got %v", got)
+	}
+
+	_, err = ReadDefaultACL(fsys, name)
+	if perr, ok := err.(*os.PathError); !ok || perr.Path != name || !errors.Is(err, ErrNotDirectory) {
+		t.Errorf("unexpected error reading default ACL of file: %v", err)
+	}
+	if _, err := ReadACL(fsys, "../"+name); err == nil {
+		t.Errorf("expected error reading ACL with invalid path")
+	}
+
+	// like os.DirFS, an empty root is rejected rather than
+	// referring to the working directory
+	if _, err := ReadACL(DirFS(""), "."); err == nil {
+		t.Errorf("expected error reading ACL with empty root")
+	}
+	if _, ok := fsys.(fs.ReadFileFS); !ok {
+		t.Errorf("expected DirFS to implement fs.ReadFileFS")
+	}
+	if _, ok := fsys.(fs.ReadDirFS); !ok {
+		t.Errorf("expected DirFS to implement fs.ReadDirFS")
+	}
+}
@@ -0,0 +1,336 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	pathpkg "path"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// flags for Setxattr, defined in linux/xattr.h
+const (
+	xattrCreate  = 0x1
+	xattrReplace = 0x2
+)
+
+// MemBackend is an in-memory Backend which models a file
+// system with the ACL semantics of Linux. It is intended for
+// testing code which manipulates ACLs without requiring a
+// file system which supports them.
+//
+// Paths are slash-separated and relative to the root
+// directory, which always exists; for example, "a/b",
+// "/a/b", and "a//b/" all name the same file. Setting the
+// access ACL of a file updates the permission bits of its
+// mode, and access ACLs which are equivalent to the mode
+// are not stored, as on Linux. Files and directories
+// created with Create and Mkdir inherit the default ACL of
+// their parent directory as described in the documentation
+// for Inherit. Files are owned by user and group 0 until
+// they are given to another owner with Chown. Symbolic
+// links are not supported, so the L methods are the same
+// as their counterparts. A MemBackend is safe for
+// concurrent use.
+type MemBackend struct {
+	mu    sync.Mutex
+	files map[string]*memFile
+}
+
+type memFile struct {
+	mode   os.FileMode
+	owner  FileOwner
+	xattrs map[string][]byte
+}
+
+// NewMemBackend returns a MemBackend containing only
+// the root directory, whose mode is 0755.
+func NewMemBackend() *MemBackend {
+	return &MemBackend{files: map[string]*memFile{
+		"/": {mode: os.ModeDir | 0755, xattrs: make(map[string][]byte)},
+	}}
+}
+
+func cleanMemPath(name string) string {
+	return pathpkg.Clean("/" + name)
+}
+
+// Create creates an empty regular file like os.Create, but
+// with the permission bits perm. Unlike os.Create, it fails
+// if the file already exists. No umask is applied.
+//
+// Create, Mkdir, Chmod, Chown, and Remove implement Backend.
+func (m *MemBackend) Create(name string, perm os.FileMode) error {
+	return m.create("open", name, perm, false)
+}
+
+// Mkdir creates a directory like os.Mkdir,
+// except that no umask is applied.
+func (m *MemBackend) Mkdir(name string, perm os.FileMode) error {
+	return m.create("mkdir", name, perm, true)
+}
+
+func (m *MemBackend) create(op, name string, perm os.FileMode, isDir bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := cleanMemPath(name)
+	if _, ok := m.files[p]; ok {
+		return &os.PathError{Op: op, Path: name, Err: syscall.EEXIST}
+	}
+	parent, ok := m.files[pathpkg.Dir(p)]
+	switch {
+	case !ok:
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOENT}
+	case !parent.mode.IsDir():
+		return &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+	}
+
+	f := &memFile{mode: perm.Perm(), xattrs: make(map[string][]byte)}
+	if isDir {
+		f.mode |= os.ModeDir
+	}
+	if xattr, ok := parent.xattrs[aclEADefault]; ok {
+		// stored ACLs are always well-formed
+		parentDefault, _ := UnmarshalXattr(xattr)
+		access, def := Inherit(parentDefault, perm, isDir)
+		f.setAccess(access)
+		if def != nil {
+			f.xattrs[aclEADefault] = append([]byte(nil), xattr...)
+		}
+	}
+	m.files[p] = f
+	return nil
+}
+
+// Chmod changes the mode of the named file like os.Chmod.
+// As on Linux, if the file has an extended access ACL, the
+// ACL is updated as described in the documentation for
+// ACL.Chmod.
+func (m *MemBackend) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[cleanMemPath(name)]
+	if !ok {
+		return &os.PathError{Op: "chmod", Path: name, Err: syscall.ENOENT}
+	}
+	const bits = os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	f.mode = f.mode&^bits | mode&bits
+	if xattr, ok := f.xattrs[aclEAAccess]; ok {
+		acl, _ := UnmarshalXattr(xattr)
+		f.xattrs[aclEAAccess], _ = MarshalXattr(acl.Chmod(mode))
+	}
+	return nil
+}
+
+// Chown changes the owner and group of the named file
+// like os.Chown. A uid or gid of -1 is left unchanged.
+func (m *MemBackend) Chown(name string, uid, gid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[cleanMemPath(name)]
+	if !ok {
+		return &os.PathError{Op: "chown", Path: name, Err: syscall.ENOENT}
+	}
+	if uid != -1 {
+		f.owner.UID = UID(uid)
+	}
+	if gid != -1 {
+		f.owner.GID = GID(gid)
+	}
+	return nil
+}
+
+// Remove removes the named file or empty directory.
+func (m *MemBackend) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := cleanMemPath(name)
+	f, ok := m.files[p]
+	switch {
+	case !ok:
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOENT}
+	case p == "/":
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.EBUSY}
+	case f.mode.IsDir():
+		for q := range m.files {
+			if pathpkg.Dir(q) == p {
+				return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+	}
+	delete(m.files, p)
+	return nil
+}
+
+// Getxattr implements Backend.
+func (m *MemBackend) Getxattr(name, attr string, dest []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[cleanMemPath(name)]
+	if !ok {
+		return -1, syscall.ENOENT
+	}
+	v, ok := f.xattrs[attr]
+	switch {
+	case !ok:
+		return -1, errNoData
+	case len(dest) == 0:
+		return len(v), nil
+	case len(dest) < len(v):
+		return -1, syscall.ERANGE
+	}
+	return copy(dest, v), nil
+}
+
+// Setxattr implements Backend.
+func (m *MemBackend) Setxattr(name, attr string, data []byte, flags int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[cleanMemPath(name)]
+	if !ok {
+		return syscall.ENOENT
+	}
+	_, exists := f.xattrs[attr]
+	switch {
+	case flags&xattrCreate != 0 && exists:
+		return syscall.EEXIST
+	case flags&xattrReplace != 0 && !exists:
+		return errNoData
+	}
+
+	switch attr {
+	case aclEAAccess, aclEADefault:
+		var acl ACL
+		if len(data) > 0 {
+			var err error
+			if acl, err = UnmarshalXattr(data); err != nil {
+				return syscall.EINVAL
+			}
+		}
+		switch {
+		case len(acl) == 0:
+			// like the kernel, treat an empty ACL as a request
+			// to remove it, even on a file which can't have one
+			delete(f.xattrs, attr)
+			return nil
+		case attr == aclEADefault && !f.mode.IsDir():
+			return syscall.EACCES
+		case !acl.IsValid():
+			return syscall.EINVAL
+		case attr == aclEAAccess:
+			f.setAccess(acl)
+			return nil
+		}
+	}
+	f.xattrs[attr] = append([]byte(nil), data...)
+	return nil
+}
+
+// setAccess sets the access ACL of f, which must be valid,
+// updating its mode. As Linux does, the ACL is only stored
+// if it is not equivalent to the mode; any ACL with more
+// than the three required entries is stored, even if its
+// mask entry grants the same permissions as TagGroupObj.
+func (f *memFile) setAccess(acl ACL) {
+	f.mode = f.mode&^os.ModePerm | ToMode(acl)
+	if len(acl) > 3 {
+		f.xattrs[aclEAAccess], _ = MarshalXattr(acl)
+		return
+	}
+	delete(f.xattrs, aclEAAccess)
+}
+
+// Removexattr implements Backend.
+func (m *MemBackend) Removexattr(name, attr string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, ok := m.files[cleanMemPath(name)]
+	if !ok {
+		return syscall.ENOENT
+	}
+	if _, ok := f.xattrs[attr]; !ok {
+		return errNoData
+	}
+	delete(f.xattrs, attr)
+	return nil
+}
+
+// Lgetxattr implements Backend.
+func (m *MemBackend) Lgetxattr(name, attr string, dest []byte) (int, error) {
+	return m.Getxattr(name, attr, dest)
+}
+
+// Lsetxattr implements Backend.
+func (m *MemBackend) Lsetxattr(name, attr string, data []byte, flags int) error {
+	return m.Setxattr(name, attr, data, flags)
+}
+
+// Lremovexattr implements Backend.
+func (m *MemBackend) Lremovexattr(name, attr string) error {
+	return m.Removexattr(name, attr)
+}
+
+// Stat implements Backend. The Sys method of the
+// returned os.FileInfo returns a *FileOwner.
+func (m *MemBackend) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := cleanMemPath(name)
+	f, ok := m.files[p]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: syscall.ENOENT}
+	}
+	return f.info(p), nil
+}
+
+// Lstat implements Backend.
+func (m *MemBackend) Lstat(name string) (os.FileInfo, error) {
+	return m.Stat(name)
+}
+
+// ReadDir implements Backend.
+func (m *MemBackend) ReadDir(name string) ([]os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p := cleanMemPath(name)
+	f, ok := m.files[p]
+	switch {
+	case !ok:
+		return nil, &os.PathError{Op: "open", Path: name, Err: syscall.ENOENT}
+	case !f.mode.IsDir():
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	var infos []os.FileInfo
+	for q, child := range m.files {
+		if q != "/" && pathpkg.Dir(q) == p {
+			infos = append(infos, child.info(q))
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (f *memFile) info(p string) os.FileInfo {
+	owner := f.owner
+	return memFileInfo{name: pathpkg.Base(p), mode: f.mode, owner: &owner}
+}
+
+type memFileInfo struct {
+	name  string
+	mode  os.FileMode
+	owner *FileOwner
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return 0 }
+func (fi memFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi memFileInfo) ModTime() time.Time { return time.Time{} }
+func (fi memFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi memFileInfo) Sys() interface{}   { return fi.owner }
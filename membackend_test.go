@@ -0,0 +1,397 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+// TestMemBackend performs the same operations using the
+// OS and a MemBackend, and checks that they agree.
+func TestMemBackend(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	mem := NewMemBackend()
+	testutil.Must(t, mem.Mkdir("root", 0700))
+
+	// created is the path, relative to the root,
+	// of the file created by the step, if any
+	type step struct {
+		name, created string
+		do            func(fs FS, root string) error
+	}
+	def := ACL{{TagUserObj, "", 7}, {TagUser, "0", 7}, {TagGroupObj, "", 5}, {TagMask, "", 7}, {TagOther, "", 0}}
+	steps := []step{
+		{"setdefault", "", func(fs FS, root string) error { return fs.SetDefault(root, def) }},
+		{"mkdir", "/dir", func(fs FS, root string) error {
+			if fs.Backend == OSBackend {
+				return os.Mkdir(filepath.Join(root, "dir"), 0750)
+			}
+			return mem.Mkdir(root+"/dir", 0750)
+		}},
+		{"create", "/dir/file", func(fs FS, root string) error {
+			if fs.Backend == OSBackend {
+				f, err := os.OpenFile(filepath.Join(root, "dir", "file"), os.O_CREATE|os.O_EXCL, 0640)
+				if err == nil {
+					f.Close()
+				}
+				return err
+			}
+			return mem.Create(root+"/dir/file", 0640)
+		}},
+		{"add", "", func(fs FS, root string) error {
+			return fs.Add(root+"/dir/file", Entry{TagGroup, "0", 6})
+		}},
+		{"chmod", "", func(fs FS, root string) error {
+			if fs.Backend == OSBackend {
+				return os.Chmod(filepath.Join(root, "dir", "file"), 0604)
+			}
+			return mem.Chmod(root+"/dir/file", 0604)
+		}},
+		{"fs.chmod", "", func(fs FS, root string) error { return fs.Chmod(root+"/dir", 0711) }},
+		{"remove", "", func(fs FS, root string) error {
+			return fs.Remove(root+"/dir/file", Key{TagUser, "0"})
+		}},
+		{"set", "", func(fs FS, root string) error {
+			return fs.Set(root+"/dir", ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagMask, "", 6}, {TagOther, "", 1}})
+		}},
+		{"removeextended", "", func(fs FS, root string) error { return fs.RemoveExtended(root + "/dir/file") }},
+		{"removedefault", "", func(fs FS, root string) error { return fs.RemoveDefault(root + "/dir") }},
+	}
+
+	type state struct {
+		mode          os.FileMode
+		access, deflt ACL
+	}
+	snapshot := func(fs FS, path string) state {
+		fi, err := fs.Backend.Stat(path)
+		testutil.Must(t, err)
+		access, err := fs.Get(path)
+		testutil.Must(t, err)
+		var deflt ACL
+		if fi.IsDir() {
+			deflt, err = fs.GetDefault(path)
+			testutil.Must(t, err)
+		}
+		return state{fi.Mode() & os.ModePerm, access, deflt}
+	}
+
+	osFS, memFS := FS{Backend: OSBackend}, FS{Backend: mem}
+	var paths []string
+	for _, s := range steps {
+		testutil.Must(t, s.do(osFS, d))
+		testutil.Must(t, s.do(memFS, "/root"))
+		if s.created != "" {
+			paths = append(paths, s.created)
+		}
+		for _, p := range append([]string{""}, paths...) {
+			want, got := snapshot(osFS, d+p), snapshot(memFS, "/root"+p)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("after %v: %v: want %+v; got %+v", s.name, p, want, got)
+			}
+		}
+	}
+}
+
+func TestMemBackendErrors(t *testing.T) {
+	mem := NewMemBackend()
+	fs := FS{Backend: mem}
+	testutil.Must(t, mem.Create("file", 0644))
+
+	if err := mem.Create("/file", 0644); !os.IsExist(err) {
+		t.Errorf("unexpected error creating existing file: %v", err)
+	}
+	if err := mem.Mkdir("a/b", 0755); !os.IsNotExist(err) {
+		t.Errorf("unexpected error creating file in missing directory: %v", err)
+	}
+	if _, err := fs.Get("missing"); !os.IsNotExist(err) {
+		t.Errorf("unexpected error getting ACL of missing file: %v", err)
+	}
+	err := fs.SetDefault("file", base)
+	if !isSentinelError(err, ErrNotDirectory) {
+		t.Errorf("unexpected error setting default ACL of file: %v", err)
+	}
+	// as on Linux, only a non-empty default ACL is rejected
+	empty, err := MarshalXattr(ACL{})
+	testutil.Must(t, err)
+	if err := mem.Setxattr("file", aclEADefault, empty, 0); err != nil {
+		t.Errorf("unexpected error setting empty default ACL of file: %v", err)
+	}
+	if err := mem.Setxattr("file", aclEAAccess, []byte{1, 2, 3}, 0); err != syscall.EINVAL {
+		t.Errorf("unexpected error setting malformed ACL: %v", err)
+	}
+	if err := mem.Setxattr("file", "user.foo", nil, xattrReplace); err != errNoData {
+		t.Errorf("unexpected error replacing missing attribute: %v", err)
+	}
+
+	testutil.Must(t, mem.Mkdir("dir", 0755))
+	testutil.Must(t, mem.Create("dir/file", 0644))
+	if err := mem.Remove("dir"); err == nil {
+		t.Errorf("expected error removing non-empty directory")
+	}
+	testutil.Must(t, mem.Remove("dir/file"))
+	testutil.Must(t, mem.Remove("dir"))
+}
+
+// TestFSOptions checks that an FS behaves like its Options.
+func TestFSOptions(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+	mem := NewMemBackend()
+	testutil.Must(t, mem.Create("file", 0600))
+
+	// setfacl --set requires a mask entry to be added
+	acl := ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagOther, "", 0}}
+	for _, o := range []Options{{}, {NoMaskRecalc: true}} {
+		fs := FS{Backend: mem, Options: o}
+		wantErr, gotErr := o.Set(f, acl), fs.Set("file", acl)
+		if (wantErr == nil) != (gotErr == nil) {
+			t.Errorf("%+v: unexpected error: want %v; got %v", o, wantErr, gotErr)
+			continue
+		}
+		if wantErr != nil {
+			continue
+		}
+		want, err := Get(f)
+		testutil.Must(t, err)
+		got, err := fs.Get("file")
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(want, got) {
+			t.Errorf("%+v: unexpected ACL: want %v; got %v", o, want, got)
+		}
+	}
+}
+
+// TestFSRecursive performs the same recursive operations
+// using the OS and a MemBackend, and checks that they agree.
+func TestFSRecursive(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	mem := NewMemBackend()
+	testutil.Must(t, mem.Mkdir("root", 0700))
+	osFS, memFS := FS{Backend: OSBackend}, FS{Backend: mem}
+	paths := []string{"", "/dir", "/dir/file", "/file"}
+	for _, fs := range []FS{osFS, memFS} {
+		root := d
+		if fs.Backend == mem {
+			root = "/root"
+		}
+		testutil.Must(t, fs.Backend.Mkdir(root+"/dir", 0750))
+		testutil.Must(t, fs.Backend.Create(root+"/dir/file", 0740))
+		testutil.Must(t, fs.Backend.Create(root+"/file", 0640))
+	}
+
+	acl := ACL{{TagUserObj, "", 7}, {TagUser, "0", 6}, {TagGroupObj, "", 4 | ConditionalExecute},
+		{TagMask, "", 7}, {TagOther, "", 0}}
+	type step struct {
+		name string
+		do   func(fs FS, root string) error
+	}
+	steps := []step{
+		{"setrecursive", func(fs FS, root string) error { return fs.SetRecursive(root, acl, acl, nil) }},
+		{"addrecursive", func(fs FS, root string) error {
+			return fs.AddRecursive(root, []Entry{{TagGroup, "0", 5}}, []Entry{{TagUser, "0", 7}},
+				&WalkOptions{ConditionalExecute: true})
+		}},
+		{"addrecursive nomaskrecalc", func(fs FS, root string) error {
+			return fs.AddRecursive(root, []Entry{{TagUser, "0", 7}}, nil,
+				&WalkOptions{NoFollow: true, NoMaskRecalc: true})
+		}},
+	}
+	snapshot := func(fs FS, path string) FileACL {
+		fa, err := fs.GetFileACL(path)
+		testutil.Must(t, err)
+		fi, err := fs.Backend.Lstat(path)
+		testutil.Must(t, err)
+		// the owners and paths differ; compare the
+		// permission bits instead
+		return FileACL{Flags: fi.Mode().Perm(), Access: fa.Access, Default: fa.Default}
+	}
+	for _, s := range steps {
+		testutil.Must(t, s.do(osFS, d))
+		testutil.Must(t, s.do(memFS, "/root"))
+		for _, p := range paths {
+			want, got := snapshot(osFS, d+p), snapshot(memFS, "/root"+p)
+			if !reflect.DeepEqual(want, got) {
+				t.Errorf("after %v: %v: want %+v; got %+v", s.name, p, want, got)
+			}
+		}
+	}
+
+	infos, err := mem.ReadDir("/root")
+	testutil.Must(t, err)
+	if len(infos) != 2 || infos[0].Name() != "dir" || infos[1].Name() != "file" {
+		t.Errorf("unexpected directory entries: %v", infos)
+	}
+	if _, err := mem.ReadDir("/root/file"); err == nil {
+		t.Errorf("expected error reading file as directory")
+	}
+}
+
+func TestFSDumpRestore(t *testing.T) {
+	src, dst := NewMemBackend(), NewMemBackend()
+	for _, mem := range []*MemBackend{src, dst} {
+		testutil.Must(t, mem.Mkdir("dir", 0755))
+		testutil.Must(t, mem.Create("dir/file", 0644))
+		testutil.Must(t, mem.Mkdir("dir/sub", 0755))
+	}
+	testutil.Must(t, src.Chown("dir/file", 1000, 2000))
+	testutil.Must(t, src.Chmod("dir/sub", 0750|os.ModeSticky))
+	fs := FS{Backend: src}
+	testutil.Must(t, fs.Set("dir/file", ACL{{TagUserObj, "", 6}, {TagUser, "1000", 4},
+		{TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}))
+	testutil.Must(t, fs.SetDefault("dir/sub", ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5},
+		{TagGroup, "2000", 7}, {TagMask, "", 7}, {TagOther, "", 0}}))
+
+	dump := func(fs FS) string {
+		var buf bytes.Buffer
+		testutil.Must(t, fs.Dump(&buf, "/dir", &DumpOptions{Numeric: true}))
+		return buf.String()
+	}
+	want := dump(fs)
+	err := FS{Backend: dst}.Restore(bytes.NewBufferString(want), &RestoreOptions{
+		Owner: true, Dir: "/", Resolver: NumericResolver{}})
+	testutil.Must(t, err)
+	if got := dump(FS{Backend: dst}); got != want {
+		t.Errorf("unexpected dump after restore: want:\n%v\ngot:\n%v", want, got)
+	}
+
+	err = FS{Backend: dst}.Restore(bytes.NewBufferString("# file: missing\nu::rw-\ng::r--\no::r--\n"),
+		&RestoreOptions{Dir: "/"})
+	if merr, ok := err.(MultiError); !ok || len(merr) != 1 || !os.IsNotExist(merr[0]) {
+		t.Errorf("unexpected error restoring missing file: %v", err)
+	}
+}
+
+func TestFSCheckAccess(t *testing.T) {
+	mem := NewMemBackend()
+	fs := FS{Backend: mem}
+	testutil.Must(t, mem.Create("file", 0640))
+	testutil.Must(t, mem.Chown("file", 1000, 2000))
+	testutil.Must(t, fs.Add("file", Entry{TagUser, "3000", 6}))
+
+	for _, c := range []struct {
+		cred  Credentials
+		perms os.FileMode
+		want  bool
+	}{
+		{Credentials{UID: 1000}, 6, true},
+		{Credentials{UID: 1001, GID: 2000}, 4, true},
+		{Credentials{UID: 1001, Groups: []GID{2000}}, 6, false},
+		{Credentials{UID: 3000}, 6, true},
+		{Credentials{UID: 4000}, 4, false},
+	} {
+		got, err := fs.CheckAccess("file", c.cred, c.perms)
+		testutil.Must(t, err)
+		if got != c.want {
+			t.Errorf("%+v, %o: unexpected result: want %v; got %v", c.cred, c.perms, c.want, got)
+		}
+	}
+	if _, err := fs.CheckAccess("missing", Credentials{}, 4); !os.IsNotExist(err) {
+		t.Errorf("unexpected error checking access to missing file: %v", err)
+	}
+}
+
+func TestFSCreate(t *testing.T) {
+	mem := NewMemBackend()
+	fs := FS{Backend: mem}
+	def := ACL{{TagUserObj, "", 7}, {TagUser, "1000", 7}, {TagGroupObj, "", 5}, {TagMask, "", 7}, {TagOther, "", 0}}
+	testutil.Must(t, fs.SetDefault("/", def))
+
+	acl := ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagGroup, "2000", 6}, {TagMask, "", 6}, {TagOther, "", 0}}
+	testutil.Must(t, fs.CreateWithACL("file", acl))
+	testutil.Must(t, fs.MkdirWithACL("dir", acl, nil))
+	testutil.Must(t, fs.MkdirWithACL("dir2", base, def))
+	for _, c := range []struct {
+		path         string
+		access, dflt ACL
+	}{
+		{"file", acl, nil},
+		{"dir", acl, nil},
+		{"dir2", base, def},
+	} {
+		fa, err := fs.GetFileACL(c.path)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(fa.Access, c.access) || !reflect.DeepEqual(fa.Default, c.dflt) {
+			t.Errorf("%v: unexpected ACLs: want %v, %v; got %v, %v", c.path, c.access, c.dflt, fa.Access, fa.Default)
+		}
+	}
+
+	if err := fs.CreateWithACL("file", acl); !os.IsExist(err) {
+		t.Errorf("unexpected error creating existing file: %v", err)
+	}
+	invalid := ACL{{TagUserObj, "", 7}}
+	if err, ok := fs.CreateWithACL("file2", invalid).(*os.PathError); !ok || err.Op != "create" {
+		t.Errorf("unexpected error creating file with invalid ACL: %v", err)
+	}
+	if err, ok := fs.MkdirWithACL("dir3", base, invalid).(*os.PathError); !ok || err.Op != "mkdir" {
+		t.Errorf("unexpected error creating directory with invalid default ACL: %v", err)
+	}
+	for _, p := range []string{"file2", "dir3"} {
+		if _, err := mem.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("unexpected error for %v after failed creation: %v", p, err)
+		}
+	}
+}
+
+func TestFSAt(t *testing.T) {
+	mem := NewMemBackend()
+	fs := FS{Backend: mem}
+	testutil.Must(t, mem.Mkdir("dir", 0755))
+	testutil.Must(t, mem.Mkdir("dir/sub", 0755))
+	testutil.Must(t, mem.Create("dir/sub/file", 0644))
+
+	acl := ACL{{TagUserObj, "", 6}, {TagUser, "1000", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	testutil.Must(t, fs.SetAt("dir", "sub/file", acl))
+	testutil.Must(t, fs.SetDefaultAt("dir", "./sub", acl))
+	got, err := fs.GetAt("dir", "sub/file")
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+	got, err = fs.GetDefaultAt("dir", "sub/")
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected default ACL: want %v; got %v", acl, got)
+	}
+
+	// MemBackend has no symbolic links, so the L
+	// methods behave like their counterparts
+	testutil.Must(t, fs.LSet("dir/sub/file", base))
+	testutil.Must(t, fs.LSetDefault("dir/sub", base))
+	if got, err := fs.LGet("dir/sub/file"); err != nil || !reflect.DeepEqual(got, base) {
+		t.Errorf("unexpected ACL: want %v; got %v (error: %v)", base, got, err)
+	}
+	if got, err := fs.LGetDefault("dir/sub"); err != nil || !reflect.DeepEqual(got, base) {
+		t.Errorf("unexpected default ACL: want %v; got %v (error: %v)", base, got, err)
+	}
+
+	for _, c := range []struct {
+		name string
+		want error
+	}{
+		{"", syscall.ENOENT},
+		{"/dir/sub", syscall.EXDEV},
+		{"sub/../sub", syscall.EXDEV},
+		{"sub/file/x", syscall.ENOTDIR},
+	} {
+		_, err := fs.GetAt("dir", c.name)
+		if pe, ok := err.(*os.PathError); !ok || pe.Err != c.want {
+			t.Errorf("%q: unexpected error: want %v; got %v", c.name, c.want, err)
+		}
+	}
+	if _, err := fs.GetAt("dir", "sub/missing"); !os.IsNotExist(err) {
+		t.Errorf("unexpected error getting ACL of missing file: %v", err)
+	}
+}
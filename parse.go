@@ -0,0 +1,495 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// SyntaxError is returned when parsing the text form
+// of an ACL or entry fails.
+type SyntaxError struct {
+	Line   int    // line number (starting at 1) of the error, or 0 for single-line input
+	Offset int    // byte offset in the input at which the error was detected
+	Msg    string // description of the error
+}
+
+func (e *SyntaxError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("syntax error on line %d (offset %d): %s", e.Line, e.Offset, e.Msg)
+	}
+	return fmt.Sprintf("syntax error at offset %d: %s", e.Offset, e.Msg)
+}
+
+// Parse parses the POSIX.1e short text form of an ACL
+// as produced by ACL.String. For example:
+//  u::rwx,g::r-x,o::---,u:dvader:r--,m::r--
+// Entries may be separated by commas or newlines, and
+// whitespace is allowed around entries and their fields.
+// A # character starts a comment which extends to the
+// end of the line, so the output of ACL.StringLong is
+// also accepted. See ParseEntry for the syntax of
+// individual entries.
+//
+// Parse does not check that the resulting ACL is valid;
+// use the IsValid method to do so.
+func Parse(s string) (ACL, error) {
+	return ParseWith(s, defaultResolver)
+}
+
+// ParseWith is like Parse, but uses r to resolve
+// user and group names.
+func ParseWith(s string, r Resolver) (ACL, error) {
+	var acl ACL
+	start := 0
+	for start < len(s) {
+		end := strings.IndexAny(s[start:], ",\n#")
+		if end == -1 {
+			end = len(s)
+		} else {
+			end += start
+		}
+		text := s[start:end]
+		next := end + 1
+		if end < len(s) && s[end] == '#' {
+			// skip the comment
+			if nl := strings.IndexByte(s[end:], '\n'); nl == -1 {
+				next = len(s)
+			} else {
+				next = end + nl + 1
+			}
+		}
+		if strings.TrimSpace(text) == "" {
+			// allow blank lines, comment lines, and trailing separators
+			if end == len(s) || s[end] != ',' || strings.TrimSpace(s[next:]) == "" {
+				start = next
+				continue
+			}
+			return nil, &SyntaxError{Offset: start, Msg: "empty entry"}
+		}
+		e, err := parseEntry(text, start, r)
+		if err != nil {
+			return nil, err
+		}
+		acl = append(acl, e)
+		start = next
+	}
+	return acl, nil
+}
+
+// ParseEntry parses the POSIX.1e short text form of
+// an entry as produced by Entry.String. An entry consists
+// of three colon-separated fields: a tag, a qualifier, and
+// a permissions string. For example:
+//  u:dvader:r--
+// The tag may be given either in its short form (u, g, o,
+// or m) or in its long form (user, group, other, or mask).
+// The qualifier is empty for entries with the tags
+// TagUserObj, TagGroupObj, TagOther, and TagMask, and may
+// be omitted entirely (together with its colon) for entries
+// with the tags TagOther and TagMask. For named user and
+// group entries, it may be either a numeric UID or GID or
+// a user or group name, in which case the name is resolved
+// to the corresponding ID. The permissions string consists
+// of the characters r, w, x, X, and -, in any order, where
+// X stands for the ConditionalExecute bit. As in getfacl's
+// output, octal escape sequences (such as \040 for a space)
+// in names are decoded.
+func ParseEntry(s string) (Entry, error) {
+	return ParseEntryWith(s, defaultResolver)
+}
+
+// ParseEntryWith is like ParseEntry, but uses r
+// to resolve user and group names.
+func ParseEntryWith(s string, r Resolver) (Entry, error) {
+	return parseEntry(s, 0, r)
+}
+
+// parseEntry parses the entry in s, reporting errors
+// relative to the offset off of s in the original input
+// and resolving user and group names with r.
+func parseEntry(s string, off int, r Resolver) (Entry, error) {
+	fields := strings.Split(s, ":")
+	offsets := make([]int, len(fields))
+	pos := off
+	for i, f := range fields {
+		offsets[i] = pos
+		pos += len(f) + 1
+	}
+	field := func(i int) (string, int) {
+		f := fields[i]
+		trimmed := strings.TrimLeft(f, " \t\r\n")
+		return strings.TrimSpace(trimmed), offsets[i] + len(f) - len(trimmed)
+	}
+
+	tagText, tagOff := field(0)
+	var e Entry
+	switch tagText {
+	case "u", "user":
+		e.Tag = TagUserObj
+	case "g", "group":
+		e.Tag = TagGroupObj
+	case "o", "other":
+		e.Tag = TagOther
+	case "m", "mask":
+		e.Tag = TagMask
+	case "":
+		return Entry{}, &SyntaxError{Offset: tagOff, Msg: "missing tag"}
+	default:
+		return Entry{}, &SyntaxError{Offset: tagOff, Msg: fmt.Sprintf("unknown tag %q", tagText)}
+	}
+
+	var permText string
+	var permOff int
+	switch len(fields) {
+	case 2:
+		if e.Tag != TagOther && e.Tag != TagMask {
+			return Entry{}, &SyntaxError{Offset: offsets[1] - 1, Msg: "missing qualifier field"}
+		}
+		permText, permOff = field(1)
+	case 3:
+		qual, qualOff := field(1)
+		if qual != "" {
+			switch e.Tag {
+			case TagUserObj:
+				e.Tag = TagUser
+			case TagGroupObj:
+				e.Tag = TagGroup
+			default:
+				return Entry{}, &SyntaxError{Offset: qualOff,
+					Msg: fmt.Sprintf("unexpected qualifier for tag %s", e.Tag.StringLong())}
+			}
+			q, err := ParseQualifier(unquote(qual)).ResolveWith(e.Tag, r)
+			if err != nil {
+				return Entry{}, &SyntaxError{Offset: qualOff, Msg: err.Error()}
+			}
+			e.Qualifier = q.String()
+		}
+		permText, permOff = field(2)
+	default:
+		if len(fields) < 2 {
+			return Entry{}, &SyntaxError{Offset: off + len(s), Msg: "missing permissions"}
+		}
+		return Entry{}, &SyntaxError{Offset: offsets[3] - 1, Msg: "too many fields"}
+	}
+
+	perms, err := parsePerms(permText, permOff)
+	if err != nil {
+		return Entry{}, err
+	}
+	e.Perms = perms
+	return e, nil
+}
+
+// parsePerms parses a permissions string such as "r-x",
+// reporting errors relative to the offset off.
+func parsePerms(s string, off int) (os.FileMode, error) {
+	if s == "" {
+		return 0, &SyntaxError{Offset: off, Msg: "missing permissions"}
+	}
+	var perms os.FileMode
+	for i, c := range s {
+		var bit os.FileMode
+		switch c {
+		case 'r':
+			bit = 4
+		case 'w':
+			bit = 2
+		case 'x':
+			bit = 1
+		case 'X':
+			bit = ConditionalExecute
+		case '-':
+			continue
+		default:
+			return 0, &SyntaxError{Offset: off + i, Msg: fmt.Sprintf("invalid permission character %q", c)}
+		}
+		if perms&bit != 0 {
+			return 0, &SyntaxError{Offset: off + i, Msg: fmt.Sprintf("duplicate permission character %q", c)}
+		}
+		perms |= bit
+	}
+	return perms, nil
+}
+
+// FileACL holds the ACLs of a single file along with the
+// metadata from the comment header that getfacl prints
+// before them in the long text form. A *FileACL may also
+// be used as the Sys value of an fs.FileInfo to attach ACLs
+// to files in file systems such as fstest.MapFS; see
+// ReadACL.
+type FileACL struct {
+	Path  string // from the "# file:" header, with escape sequences decoded
+	Owner string // from the "# owner:" header; a user name or UID, with escape sequences decoded
+	Group string // from the "# group:" header; a group name or GID, with escape sequences decoded
+
+	// Flags holds the special mode bits from the "# flags:"
+	// header as a combination of os.ModeSetuid, os.ModeSetgid,
+	// and os.ModeSticky.
+	Flags os.FileMode
+
+	Access  ACL // the access ACL
+	Default ACL // the default ACL, or nil if there are no default entries
+}
+
+// ParseLong parses the POSIX.1e long text form of an ACL
+// in the format produced by getfacl for a single file.
+// For example:
+//  # file: somedir
+//  # owner: dvader
+//  # group: empire
+//  # flags: -s-
+//  user::rwx
+//  user:lskywalker:rwx     #effective:r-x
+//  group::r-x
+//  mask::r-x
+//  other::---
+//  default:user::rwx
+//  default:group::r-x
+//  default:other::---
+// The comment headers are optional, and comments following
+// entries (such as the #effective comments produced by
+// ACL.StringLong) are ignored. Entries prefixed with
+// "default:" (or "d:") belong to the default ACL; all other
+// entries belong to the access ACL. See ParseEntry for the
+// syntax of individual entries. Syntax errors are reported
+// as a *SyntaxError whose Line field is set.
+//
+// Like Parse, ParseLong does not check that the resulting
+// ACLs are valid.
+func ParseLong(s string) (*FileACL, error) {
+	return ParseLongWith(s, defaultResolver)
+}
+
+// ParseLongWith is like ParseLong, but uses r to
+// resolve user and group names.
+func ParseLongWith(s string, r Resolver) (*FileACL, error) {
+	p := longParser{r: r}
+	off := 0
+	for _, line := range strings.SplitAfter(s, "\n") {
+		if err := p.parseLine(strings.TrimSuffix(line, "\n"), off); err != nil {
+			return nil, err
+		}
+		off += len(line)
+	}
+	return &p.fa, nil
+}
+
+// longParser parses the long text form one line at a time.
+type longParser struct {
+	r    Resolver
+	fa   FileACL
+	line int // number of the last line parsed
+
+	// whether any entries have been parsed;
+	// headers are not allowed afterwards
+	sawEntries bool
+}
+
+// parseLine parses the next line of input, whose offset
+// from the beginning of the input is off.
+func (p *longParser) parseLine(text string, off int) error {
+	p.line++
+	lineErr := func(off int, format string, a ...interface{}) error {
+		return &SyntaxError{Line: p.line, Offset: off, Msg: fmt.Sprintf(format, a...)}
+	}
+
+	trimmed := strings.TrimLeft(text, " \t\r")
+	off += len(text) - len(trimmed)
+	text = strings.TrimRight(trimmed, " \t\r")
+	if text == "" {
+		return nil
+	}
+
+	if text[0] == '#' {
+		comment := strings.TrimLeft(text[1:], " \t")
+		for _, h := range []string{"file", "owner", "group", "flags"} {
+			if !strings.HasPrefix(comment, h+":") {
+				continue
+			}
+			if p.sawEntries {
+				return lineErr(off, "%s header after entries", h)
+			}
+			val := strings.TrimLeft(comment[len(h)+1:], " \t")
+			valOff := off + len(text) - len(val)
+			switch h {
+			case "file":
+				p.fa.Path = unquote(val)
+			case "owner":
+				p.fa.Owner = unquote(val)
+			case "group":
+				p.fa.Group = unquote(val)
+			case "flags":
+				flags, err := parseFlags(val)
+				if err != nil {
+					return lineErr(valOff, "%v", err)
+				}
+				p.fa.Flags = flags
+			}
+			return nil
+		}
+		// some other comment
+		return nil
+	}
+
+	if i := strings.IndexByte(text, '#'); i != -1 {
+		// strip trailing comments such as #effective:r--
+		text = strings.TrimRight(text[:i], " \t")
+	}
+	p.sawEntries = true
+	target := &p.fa.Access
+	for _, prefix := range []string{"default:", "d:"} {
+		if strings.HasPrefix(text, prefix) {
+			target = &p.fa.Default
+			text = text[len(prefix):]
+			off += len(prefix)
+			break
+		}
+	}
+	e, err := parseEntry(text, off, p.r)
+	if err != nil {
+		err.(*SyntaxError).Line = p.line
+		return err
+	}
+	*target = append(*target, e)
+	return nil
+}
+
+// parseFlags parses the value of getfacl's "# flags:"
+// header, such as "s-t".
+func parseFlags(s string) (os.FileMode, error) {
+	if len(s) != 3 {
+		return 0, fmt.Errorf("invalid flags %q", s)
+	}
+	var flags os.FileMode
+	for i, bit := range []struct {
+		c    byte
+		mode os.FileMode
+	}{{'s', os.ModeSetuid}, {'s', os.ModeSetgid}, {'t', os.ModeSticky}} {
+		switch s[i] {
+		case bit.c:
+			flags |= bit.mode
+		case '-':
+		default:
+			return 0, fmt.Errorf("invalid flags %q", s)
+		}
+	}
+	return flags, nil
+}
+
+// unquote decodes the octal escape sequences (such as
+// \040 for a space) which getfacl uses in file, user,
+// and group names.
+func unquote(s string) string {
+	if strings.IndexByte(s, '\\') == -1 {
+		return s
+	}
+	buf := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) && isOctal(s[i+1]) && isOctal(s[i+2]) && isOctal(s[i+3]) {
+			buf = append(buf, (s[i+1]-'0')<<6|(s[i+2]-'0')<<3|(s[i+3]-'0'))
+			i += 3
+			continue
+		}
+		buf = append(buf, s[i])
+	}
+	return string(buf)
+}
+
+func isOctal(c byte) bool { return '0' <= c && c <= '7' }
+
+// A Decoder reads a sequence of FileACLs from an input
+// stream in the format produced by getfacl when given
+// multiple files or the -R flag: a series of blocks in
+// the long text form (see ParseLong), each beginning with
+// a "# file:" header and separated by blank lines.
+type Decoder struct {
+	// Resolver is used to resolve user and group names
+	// in entries. If it is nil, the system's user and
+	// group database is used.
+	Resolver Resolver
+
+	r    *bufio.Reader
+	line int // number of lines consumed
+	off  int // number of bytes consumed
+
+	// a line which was read but belongs to the next block
+	pending    string
+	hasPending bool
+}
+
+// NewDecoder returns a new Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode reads and returns the next FileACL from its input.
+// At the end of the input, Decode returns io.EOF. Syntax
+// errors are reported as a *SyntaxError whose Line and
+// Offset are relative to the beginning of the input.
+func (d *Decoder) Decode() (*FileACL, error) {
+	p := longParser{r: d.Resolver, line: d.line}
+	if p.r == nil {
+		p.r = defaultResolver
+	}
+	var started bool
+	for {
+		line, err := d.readLine()
+		if err == io.EOF {
+			if !started {
+				return nil, io.EOF
+			}
+			return &p.fa, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		text := strings.TrimSpace(line)
+		if text == "" {
+			if started {
+				d.consume(line)
+				return &p.fa, nil
+			}
+		} else if started && p.sawEntries && isFileHeader(text) {
+			// the next block begins without a blank line
+			d.pending, d.hasPending = line, true
+			return &p.fa, nil
+		} else {
+			started = true
+		}
+		if err := p.parseLine(strings.TrimSuffix(line, "\n"), d.off); err != nil {
+			return nil, err
+		}
+		d.consume(line)
+	}
+}
+
+func (d *Decoder) readLine() (string, error) {
+	if d.hasPending {
+		d.hasPending = false
+		return d.pending, nil
+	}
+	line, err := d.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	return line, err
+}
+
+// consume records that line has been parsed.
+func (d *Decoder) consume(line string) {
+	d.line++
+	d.off += len(line)
+}
+
+func isFileHeader(text string) bool {
+	return text[0] == '#' && strings.HasPrefix(strings.TrimLeft(text[1:], " \t"), "file:")
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+// rootName and rootUID are the name and UID of root, the
+// only user whose name and UID are the same on all Unices,
+// for tests which resolve names with the system's database.
+const (
+	rootName = "root"
+	rootUID  = "0"
+)
+
+var parseTestCases = []struct {
+	Text string
+	ACL  ACL
+}{
+	{"", nil},
+	{"u::rwx,g::r-x,o::---", ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}},
+	{"user::rwx,group::r-x,other::---", ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}},
+	{" u : : rwx , g::x-r\n o:--- ", ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}}},
+	{"u:0:r--,g:0:-w-,m:rw-,o:---", ACL{{TagUser, "0", 4}, {TagGroup, "0", 2}, {TagMask, "", 6}, {TagOther, "", 0}}},
+	{"user:" + rootName + ":r--,group:123:--x,mask::r-x", ACL{{TagUser, rootUID, 4}, {TagGroup, "123", 1}, {TagMask, "", 5}}},
+	{"u::rwx,g::---,o::---,\n", ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagOther, "", 0}}},
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range parseTestCases {
+		acl, err := Parse(c.Text)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", c.Text, err)
+			continue
+		}
+		if !reflect.DeepEqual(acl, c.ACL) {
+			t.Errorf("unexpected ACL parsing %q: want %v; got %v", c.Text, c.ACL, acl)
+		}
+	}
+
+	// Make sure that the output of String round-trips
+	acl := ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 5},
+		{TagGroup, "0", 2}, {TagMask, "", 6}, {TagOther, "", 1}}
+	for _, text := range []string{acl.String(), acl.StringLong()} {
+		acl2, err := Parse(text)
+		if err != nil {
+			t.Errorf("unexpected error parsing %q: %v", text, err)
+		} else if !reflect.DeepEqual(acl, acl2) {
+			t.Errorf("unexpected ACL parsing %q: want %v; got %v", text, acl, acl2)
+		}
+	}
+}
+
+var parseErrorTestCases = []struct {
+	Text   string
+	Offset int
+}{
+	{"x::rwx", 0},
+	{"u::rwx,,o::---", 7},
+	{"u::rwx,o:0:---", 9},
+	{"u:rwx", 1},
+	{"u::rwq", 5},
+	{"u::rww", 5},
+	{"u::", 3},
+	{"u::r:w", 4},
+	{"u::rwx, g", 9},
+}
+
+func TestParseError(t *testing.T) {
+	for _, c := range parseErrorTestCases {
+		_, err := Parse(c.Text)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("unexpected error parsing %q: want *SyntaxError; got %v", c.Text, err)
+			continue
+		}
+		if serr.Offset != c.Offset {
+			t.Errorf("unexpected error offset parsing %q: want %v; got %v (%v)", c.Text, c.Offset, serr.Offset, serr)
+		}
+	}
+}
+
+func TestParseLong(t *testing.T) {
+	text := `# file: some\040dir
+# owner: root
+# group: 0
+# flags: -st
+user::rwx
+user:0:rwx              #effective:r-x
+group::r-x
+
+mask::r-x
+other::---
+default:user::rwx
+d:group::r-x
+default:other::---
+`
+	want := &FileACL{
+		Path:  "some dir",
+		Owner: "root",
+		Group: "0",
+		Flags: os.ModeSetgid | os.ModeSticky,
+		Access: ACL{{TagUserObj, "", 7}, {TagUser, "0", 7}, {TagGroupObj, "", 5},
+			{TagMask, "", 5}, {TagOther, "", 0}},
+		Default: ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 0}},
+	}
+	fa, err := ParseLong(text)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(fa, want) {
+		t.Errorf("unexpected result: want %+v; got %+v", want, fa)
+	}
+
+	for _, c := range []struct {
+		Text         string
+		Line, Offset int
+	}{
+		{"user::rwx\ngroup::r-y\n", 2, 19},
+		{"user::rwx\n# file: foo\n", 2, 10},
+		{"# flags: s\nuser::rwx\n", 1, 9},
+		{"user::rwx\n  default:other:0:---", 2, 26},
+	} {
+		_, err := ParseLong(c.Text)
+		serr, ok := err.(*SyntaxError)
+		if !ok {
+			t.Errorf("unexpected error parsing %q: want *SyntaxError; got %v", c.Text, err)
+			continue
+		}
+		if serr.Line != c.Line || serr.Offset != c.Offset {
+			t.Errorf("unexpected error position parsing %q: want %v:%v; got %v:%v (%v)",
+				c.Text, c.Line, c.Offset, serr.Line, serr.Offset, serr)
+		}
+	}
+}
+
+func TestParseLongEscapes(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "etc"), 0755))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(root, "etc", "group"), []byte("domain users:x:3000:\n"), 0644))
+
+	// as printed by getfacl for a file owned by a winbind group
+	text := `# file: some\040file
+# owner: jdoe
+# group: domain\040users
+user::rw-
+group::r--
+group:domain\040users:rwx
+mask::rwx
+other::r--
+`
+	want := &FileACL{
+		Path:  "some file",
+		Owner: "jdoe",
+		Group: "domain users",
+		Access: ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagGroup, "3000", 7},
+			{TagMask, "", 7}, {TagOther, "", 4}},
+	}
+	fa, err := ParseLongWith(text, NewFileResolver(root))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(fa, want) {
+		t.Errorf("unexpected result: want %+v; got %+v", want, fa)
+	}
+}
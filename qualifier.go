@@ -0,0 +1,227 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"errors"
+	"os"
+	"strconv"
+)
+
+// UID is a numeric user ID.
+type UID uint32
+
+// GID is a numeric group ID.
+type GID uint32
+
+// UserEntry returns an entry with the tag TagUser
+// which grants perms to the user with the given UID.
+func UserEntry(uid UID, perms os.FileMode) Entry {
+	return Entry{Tag: TagUser, Qualifier: strconv.FormatUint(uint64(uid), 10), Perms: perms}
+}
+
+// GroupEntry returns an entry with the tag TagGroup
+// which grants perms to the group with the given GID.
+func GroupEntry(gid GID, perms os.FileMode) Entry {
+	return Entry{Tag: TagGroup, Qualifier: strconv.FormatUint(uint64(gid), 10), Perms: perms}
+}
+
+// UID returns the UID of the user that e applies to.
+// If the tag of e is not TagUser, or its qualifier is
+// not a numeric UID (for example, because it is a user
+// name which has not been resolved), ok is false.
+func (e Entry) UID() (uid UID, ok bool) {
+	if e.Tag != TagUser {
+		return 0, false
+	}
+	id, ok := e.Qual().ID()
+	return UID(id), ok
+}
+
+// GID returns the GID of the group that e applies to.
+// If the tag of e is not TagGroup, or its qualifier is
+// not a numeric GID (for example, because it is a group
+// name which has not been resolved), ok is false.
+func (e Entry) GID() (gid GID, ok bool) {
+	if e.Tag != TagGroup {
+		return 0, false
+	}
+	id, ok := e.Qual().ID()
+	return GID(id), ok
+}
+
+// Qual returns the qualifier of e as a Qualifier. If the
+// tag of e is neither TagUser nor TagGroup, the result is
+// the zero Qualifier.
+func (e Entry) Qual() Qualifier {
+	if e.Tag != TagUser && e.Tag != TagGroup {
+		return Qualifier{}
+	}
+	return ParseQualifier(e.Qualifier)
+}
+
+// WithQual returns a copy of e whose qualifier is q.
+func (e Entry) WithQual(q Qualifier) Entry {
+	e.Qualifier = q.String()
+	return e
+}
+
+// Resolve returns a copy of e in which a user or group
+// name in the qualifier has been replaced by the
+// corresponding UID or GID. Entries whose qualifiers are
+// already numeric, and entries with tags other than TagUser
+// and TagGroup, are returned unchanged.
+func (e Entry) Resolve() (Entry, error) {
+	return e.ResolveWith(defaultResolver)
+}
+
+// ResolveWith is like Resolve, but uses r to
+// look up user and group names.
+func (e Entry) ResolveWith(r Resolver) (Entry, error) {
+	if e.Tag != TagUser && e.Tag != TagGroup {
+		return e, nil
+	}
+	q, err := e.Qual().ResolveWith(e.Tag, r)
+	if err != nil {
+		return e, err
+	}
+	return e.WithQual(q), nil
+}
+
+// Resolve returns a copy of a in which every entry
+// has been resolved with Entry.Resolve.
+func (a ACL) Resolve() (ACL, error) {
+	return a.ResolveWith(defaultResolver)
+}
+
+// ResolveWith is like Resolve, but uses r to
+// look up user and group names.
+func (a ACL) ResolveWith(r Resolver) (ACL, error) {
+	resolved := make(ACL, len(a))
+	for i, e := range a {
+		var err error
+		if resolved[i], err = e.ResolveWith(r); err != nil {
+			return nil, err
+		}
+	}
+	return resolved, nil
+}
+
+// Qualifier identifies the user or group that an entry
+// with the tag TagUser or TagGroup applies to. It is either
+// a numeric ID (a UID or GID, depending on the tag), or a
+// user or group name which has not yet been resolved to an
+// ID. Only numeric IDs can be stored in a file's ACL; names
+// must be resolved first (see the Resolve method).
+//
+// The zero Qualifier is invalid: it is neither an ID nor a
+// name, and it cannot be resolved or stored, so that a
+// forgotten qualifier does not silently refer to root.
+type Qualifier struct {
+	kind qualifierKind
+	id   uint32
+	name string
+}
+
+type qualifierKind uint8
+
+const (
+	qualifierInvalid qualifierKind = iota
+	qualifierID
+	qualifierName
+)
+
+// IDQualifier returns a Qualifier for the given numeric UID or GID.
+func IDQualifier(id uint32) Qualifier {
+	return Qualifier{kind: qualifierID, id: id}
+}
+
+// NameQualifier returns a Qualifier for the given user or group
+// name. The name is not resolved until the Resolve method is
+// called. Note that a name consisting only of decimal digits
+// cannot be distinguished from a numeric ID in the text form
+// or in an Entry's Qualifier field, and is always treated as
+// an ID there (as it is by setfacl). If name is empty, the
+// zero Qualifier is returned.
+func NameQualifier(name string) Qualifier {
+	if name == "" {
+		return Qualifier{}
+	}
+	return Qualifier{kind: qualifierName, name: name}
+}
+
+// ParseQualifier parses the qualifier s as stored in the
+// Qualifier field of an Entry. If s is a decimal number that
+// fits in 32 bits, it is a numeric ID; if s is empty, the
+// result is the zero Qualifier; otherwise, it is a name.
+func ParseQualifier(s string) Qualifier {
+	if id, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return IDQualifier(uint32(id))
+	}
+	return NameQualifier(s)
+}
+
+// ID returns the numeric ID of q. If q is not a
+// numeric ID, ok is false.
+func (q Qualifier) ID() (id uint32, ok bool) {
+	return q.id, q.kind == qualifierID
+}
+
+// Name returns the name of q. If q is not a name, ok is false.
+func (q Qualifier) Name() (name string, ok bool) {
+	return q.name, q.kind == qualifierName
+}
+
+// IsResolved returns whether q is a numeric ID.
+func (q Qualifier) IsResolved() bool {
+	return q.kind == qualifierID
+}
+
+// IsValid returns whether q is a numeric ID or a
+// name; that is, whether it is not the zero Qualifier.
+func (q Qualifier) IsValid() bool {
+	return q.kind != qualifierInvalid
+}
+
+// Resolve resolves q to a numeric ID by looking up the user
+// (if tag is TagUser) or group (if tag is TagGroup) with the
+// name of q in the system's user and group database. If q
+// is already a numeric ID, it is returned unchanged. If q
+// is the zero Qualifier, Resolve returns an error.
+func (q Qualifier) Resolve(tag Tag) (Qualifier, error) {
+	return q.ResolveWith(tag, defaultResolver)
+}
+
+// ResolveWith is like Resolve, but uses r to look
+// up the user or group name.
+func (q Qualifier) ResolveWith(tag Tag, r Resolver) (Qualifier, error) {
+	switch q.kind {
+	case qualifierID:
+		return q, nil
+	case qualifierInvalid:
+		return q, errors.New("missing qualifier")
+	}
+	id, err := lookupQualifier(r, q.name, tag)
+	if err != nil {
+		return q, err
+	}
+	return IDQualifier(id), nil
+}
+
+// String returns the numeric ID of q in decimal, or
+// its name if q is not resolved. This is the format of
+// the Qualifier field of Entry. The zero Qualifier is
+// formatted as the empty string.
+func (q Qualifier) String() string {
+	switch q.kind {
+	case qualifierID:
+		return strconv.FormatUint(uint64(q.id), 10)
+	case qualifierName:
+		return q.name
+	}
+	return ""
+}
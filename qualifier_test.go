@@ -0,0 +1,68 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQualifier(t *testing.T) {
+	e := UserEntry(1000, 4)
+	if want := (Entry{TagUser, "1000", 4}); e != want {
+		t.Errorf("unexpected entry: want %v; got %v", want, e)
+	}
+	if uid, ok := e.UID(); !ok || uid != 1000 {
+		t.Errorf("unexpected UID: want 1000; got %v (ok: %v)", uid, ok)
+	}
+	if _, ok := e.GID(); ok {
+		t.Errorf("unexpected GID for entry with tag TagUser")
+	}
+	if gid, ok := GroupEntry(20, 2).GID(); !ok || gid != 20 {
+		t.Errorf("unexpected GID: want 20; got %v (ok: %v)", gid, ok)
+	}
+
+	q := ParseQualifier("dvader")
+	if name, ok := q.Name(); !ok || name != "dvader" || q.IsResolved() {
+		t.Errorf("unexpected qualifier: want unresolved name dvader; got %v", q)
+	}
+	if _, ok := (Entry{Tag: TagUser, Qualifier: "dvader"}).UID(); ok {
+		t.Errorf("unexpected UID for unresolved entry")
+	}
+	if q := ParseQualifier("4294967296"); q.IsResolved() {
+		t.Errorf("qualifier out of range for a UID reported resolved: %v", q)
+	}
+
+	acl := ACL{{TagUserObj, "", 7}, {TagUser, rootName, 4}, {TagGroup, "0", 2}, {TagMask, "", 6}}
+	resolved, err := acl.Resolve()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := ACL{{TagUserObj, "", 7}, {TagUser, rootUID, 4}, {TagGroup, "0", 2}, {TagMask, "", 6}}
+	if !reflect.DeepEqual(resolved, want) {
+		t.Errorf("unexpected resolved ACL: want %v; got %v", want, resolved)
+	}
+	if _, err := NameQualifier("no such user \x00").Resolve(TagUser); err == nil {
+		t.Errorf("expected error resolving nonexistent user")
+	}
+
+	// the zero Qualifier must not mean root
+	for _, q := range []Qualifier{{}, ParseQualifier(""), NameQualifier("")} {
+		if _, ok := q.ID(); ok || q.IsResolved() || q.IsValid() {
+			t.Errorf("zero qualifier reported as an ID: %#v", q)
+		}
+		if _, err := q.Resolve(TagUser); err == nil {
+			t.Errorf("expected error resolving zero qualifier")
+		}
+		if e := (Entry{Tag: TagUser, Perms: 4}).WithQual(q); e.Qualifier != "" {
+			t.Errorf("unexpected qualifier for zero Qualifier: %q", e.Qualifier)
+		}
+	}
+	if _, err := MarshalXattr(ACL{{TagUserObj, "", 7}, {TagUser, "", 4}, {TagGroupObj, "", 0}, {TagMask, "", 4}, {TagOther, "", 0}}); err == nil {
+		t.Errorf("expected error encoding entry with empty qualifier")
+	}
+}
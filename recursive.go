@@ -0,0 +1,288 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// WalkMode determines how symbolic links are
+// handled when walking a file tree.
+type WalkMode int
+
+const (
+	// Follow symbolic links given as the root of the
+	// walk, but skip symbolic links encountered while
+	// walking (the default behavior of setfacl -R)
+	WalkDefault WalkMode = iota
+	// Follow all symbolic links to directories (setfacl -L)
+	WalkLogical
+	// Don't follow any symbolic links, including one
+	// given as the root of the walk (setfacl -P)
+	WalkPhysical
+)
+
+// WalkOptions configures the behavior of functions
+// which operate on entire file trees.
+type WalkOptions struct {
+	// Mode determines how symbolic links are handled.
+	Mode WalkMode
+
+	// If ConditionalExecute is true, all execute permissions
+	// in the entries applied to files are treated as if they
+	// were the ConditionalExecute bit. Regardless of this
+	// option, the ConditionalExecute bit is resolved for each
+	// file individually.
+	ConditionalExecute bool
+
+	// If NoFollow is true, symbolic links are never
+	// followed: Mode is ignored and the walk behaves as
+	// with WalkPhysical, and ACLs are read and set with
+	// LGet and LSet and their default ACL counterparts.
+	// A file which is replaced by a symbolic link during
+	// the walk results in an error matching ErrSymlink
+	// rather than the link being followed.
+	NoFollow bool
+
+	// If NoMaskRecalc is true, AddRecursive leaves the
+	// permissions of existing mask entries unchanged, as
+	// described in the documentation for Options.
+	NoMaskRecalc bool
+}
+
+// aclOps holds the functions used to get and set
+// ACLs during a walk, and whether mask entries are
+// recalculated when entries are added.
+type aclOps struct {
+	get, getDefault func(path string) (ACL, error)
+	set, setDefault func(path string, acl ACL) error
+	recalc          bool
+}
+
+// ops returns the ACL operations on the files of fs
+// selected by o. The mask is recalculated unless either
+// o or fs.Options sets NoMaskRecalc.
+func (fs FS) ops(o *WalkOptions) aclOps {
+	file := fs.file
+	if o.NoFollow {
+		file = fs.lfile
+	}
+	return aclOps{
+		get:        func(path string) (ACL, error) { return getType(file(path), aclEAAccess) },
+		getDefault: func(path string) (ACL, error) { return getType(file(path), aclEADefault) },
+		set:        func(path string, acl ACL) error { return setType(file(path), aclEAAccess, acl) },
+		setDefault: func(path string, acl ACL) error { return setType(file(path), aclEADefault, acl) },
+		recalc:     !o.NoMaskRecalc && !fs.Options.NoMaskRecalc,
+	}
+}
+
+// AddRecursive adds entries to the ACLs of root and, if
+// root is a directory, of every file beneath it (like
+// setfacl -R -m). The access entries are added to the
+// access ACL of each file as by Options.Add. The default
+// entries are added to the default ACL of each directory
+// as by Options.Add; if a directory has no default ACL,
+// the entries are added to a copy of the TagUserObj,
+// TagGroupObj, and TagOther entries of its access ACL, as
+// setfacl does.
+// opts may be nil, in which case the defaults are used.
+//
+// An error on one file does not stop the walk. If any
+// errors occur, AddRecursive returns a MultiError
+// containing an *os.PathError for each of them.
+func AddRecursive(root string, access, def []Entry, opts *WalkOptions) error {
+	return FS{Backend: OSBackend}.AddRecursive(root, access, def, opts)
+}
+
+// AddRecursive adds entries to the ACLs of root and the
+// files beneath it like the package-level AddRecursive.
+// Existing mask entries are left unchanged if either opts
+// or fs.Options sets NoMaskRecalc.
+func (fs FS) AddRecursive(root string, access, def []Entry, opts *WalkOptions) error {
+	return fs.walkApply(root, "add", opts, func(path string, fi os.FileInfo, ops aclOps, cond bool) error {
+		if len(access) > 0 {
+			oldACL, err := ops.get(path)
+			if err != nil {
+				return err
+			}
+			newACL, err := add(oldACL, ops.recalc, resolveExecute(access, fi, cond)...)
+			if err != nil {
+				return err
+			}
+			if err := ops.set(path, newACL); err != nil {
+				return err
+			}
+		}
+		if len(def) > 0 && fi.IsDir() {
+			oldACL, err := ops.getDefault(path)
+			if err != nil {
+				return err
+			}
+			if oldACL == nil {
+				if oldACL, err = ops.get(path); err != nil {
+					return err
+				}
+				oldACL = oldACL.minimal()
+			}
+			newACL, err := add(oldACL, ops.recalc, condExecute(def, fi)...)
+			if err != nil {
+				return err
+			}
+			return ops.setDefault(path, newACL)
+		}
+		return nil
+	})
+}
+
+// SetRecursive sets the access ACL of root and, if root
+// is a directory, of every file beneath it to access, and
+// sets the default ACL of every directory to def (like
+// setfacl -R --set). If access is nil, access ACLs are
+// left unchanged; if def is nil, default ACLs are left
+// unchanged. opts may be nil, in which case the defaults
+// are used.
+//
+// An error on one file does not stop the walk. If any
+// errors occur, SetRecursive returns a MultiError
+// containing an *os.PathError for each of them.
+func SetRecursive(root string, access, def ACL, opts *WalkOptions) error {
+	return FS{Backend: OSBackend}.SetRecursive(root, access, def, opts)
+}
+
+// SetRecursive sets the ACLs of root and the files beneath
+// it like the package-level SetRecursive.
+func (fs FS) SetRecursive(root string, access, def ACL, opts *WalkOptions) error {
+	for _, acl := range []ACL{access, def} {
+		if acl == nil {
+			continue
+		}
+		if err := acl.Validate(); err != nil {
+			return pathError("set", root, err)
+		}
+	}
+	return fs.walkApply(root, "set", opts, func(path string, fi os.FileInfo, ops aclOps, cond bool) error {
+		if access != nil {
+			if err := ops.set(path, resolveExecute(access, fi, cond)); err != nil {
+				return err
+			}
+		}
+		if def != nil && fi.IsDir() {
+			return ops.setDefault(path, condExecute(def, fi))
+		}
+		return nil
+	})
+}
+
+// resolveExecute resolves the ConditionalExecute bit in
+// entries for the file described by fi. If cond is true,
+// execute bits are first converted to ConditionalExecute.
+func resolveExecute(entries []Entry, fi os.FileInfo, cond bool) ACL {
+	if cond {
+		converted := make(ACL, len(entries))
+		for i, e := range entries {
+			if e.Perms&1 != 0 {
+				e.Perms = e.Perms&^1 | ConditionalExecute
+			}
+			converted[i] = e
+		}
+		entries = converted
+	}
+	return condExecute(entries, fi)
+}
+
+// walkApply calls fn for every file in the tree rooted at
+// root with the ACL operations selected by opts, collecting
+// the errors it returns in a MultiError as *os.PathErrors
+// with the operation op.
+func (fs FS) walkApply(root, op string, opts *WalkOptions, fn func(path string, fi os.FileInfo, ops aclOps, cond bool) error) error {
+	if opts == nil {
+		opts = &WalkOptions{}
+	}
+	mode, ops := opts.Mode, fs.ops(opts)
+	if opts.NoFollow {
+		mode = WalkPhysical
+	}
+	var errs MultiError
+	walk(fs.Backend, root, mode, func(path string, fi os.FileInfo, err error) {
+		if err == nil {
+			err = fn(path, fi, ops, opts.ConditionalExecute)
+		}
+		if err != nil {
+			if _, ok := err.(*os.PathError); !ok {
+				err = &os.PathError{Op: op, Path: path, Err: err}
+			}
+			errs = append(errs, err)
+		}
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// walk calls fn for root and every file of b beneath it
+// in lexical order, handling symbolic links according to
+// mode. fi describes the file after following symbolic
+// links if they are followed. Errors encountered while
+// walking are passed to fn along with the path that
+// caused them, and the walk continues.
+func walk(b Backend, root string, mode WalkMode, fn func(path string, fi os.FileInfo, err error)) {
+	fi, err := b.Lstat(root)
+	if err != nil {
+		fn(root, nil, err)
+		return
+	}
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if mode == WalkPhysical {
+			return
+		}
+		if fi, err = b.Stat(root); err != nil {
+			fn(root, nil, err)
+			return
+		}
+	}
+	walkDir(b, root, fi, mode, nil, fn)
+}
+
+// walkDir visits path and, if it is a directory, its
+// children. ancestors holds the directories above path,
+// which are used to detect cycles created by symbolic
+// links.
+func walkDir(b Backend, path string, fi os.FileInfo, mode WalkMode, ancestors []os.FileInfo, fn func(path string, fi os.FileInfo, err error)) {
+	fn(path, fi, nil)
+	if !fi.IsDir() {
+		return
+	}
+	for _, a := range ancestors {
+		if os.SameFile(a, fi) {
+			// we followed a symlink back into a
+			// directory we're already walking
+			return
+		}
+	}
+	ancestors = append(ancestors, fi)
+
+	infos, err := b.ReadDir(path)
+	if err != nil {
+		fn(path, nil, err)
+		return
+	}
+	for _, cfi := range infos {
+		child := filepath.Join(path, cfi.Name())
+		if cfi.Mode()&os.ModeSymlink != 0 {
+			if mode != WalkLogical {
+				continue
+			}
+			if cfi, err = b.Stat(child); err != nil {
+				fn(child, nil, err)
+				continue
+			}
+		}
+		walkDir(b, child, cfi, mode, ancestors, fn)
+	}
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestAddRecursive(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	other := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(other)
+
+	sub := filepath.Join(root, "sub")
+	testutil.Must(t, os.Mkdir(sub, 0750))
+	file := filepath.Join(sub, "file")
+	testutil.Must(t, ioutil.WriteFile(file, nil, 0640))
+	exe := filepath.Join(root, "exe")
+	testutil.Must(t, ioutil.WriteFile(exe, nil, 0750))
+	outside := filepath.Join(other, "file")
+	testutil.Must(t, ioutil.WriteFile(outside, nil, 0600))
+	testutil.Must(t, os.Symlink(other, filepath.Join(root, "link")))
+	testutil.Must(t, os.Symlink(root, filepath.Join(sub, "loop")))
+
+	err := AddRecursive(root, []Entry{{TagUser, "0", 5}}, []Entry{{TagGroup, "0", 7}},
+		&WalkOptions{ConditionalExecute: true})
+	testutil.Must(t, err)
+
+	check := func(path string, want ACL) {
+		acl, err := Get(path)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(acl, want) {
+			t.Errorf("unexpected ACL for %v: want %v; got %v", path, want, acl)
+		}
+	}
+	check(root, ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 0}, {TagMask, "", 5}, {TagOther, "", 0}})
+	check(sub, ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 5}, {TagMask, "", 5}, {TagOther, "", 0}})
+	check(exe, ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 5}, {TagMask, "", 5}, {TagOther, "", 0}})
+	check(file, ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}})
+	// symlinks below the root are not followed by default
+	check(outside, FromUnix(0600))
+
+	dacl, err := GetDefault(sub)
+	testutil.Must(t, err)
+	want := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagGroup, "0", 7}, {TagMask, "", 7}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(dacl, want) {
+		t.Errorf("unexpected default ACL: want %v; got %v", want, dacl)
+	}
+
+	// but they are followed in logical mode
+	err = AddRecursive(root, []Entry{{TagUser, "0", 5}}, nil,
+		&WalkOptions{Mode: WalkLogical, ConditionalExecute: true})
+	testutil.Must(t, err)
+	check(outside, ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagMask, "", 4}, {TagOther, "", 0}})
+
+	// and a symlink root is skipped in physical mode
+	testutil.Must(t, SetRecursive(filepath.Join(root, "link"), FromUnix(0644), nil, &WalkOptions{Mode: WalkPhysical}))
+	check(outside, ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagMask, "", 4}, {TagOther, "", 0}})
+	testutil.Must(t, SetRecursive(filepath.Join(root, "link"), FromUnix(0644), nil, nil))
+	check(outside, FromUnix(0644))
+
+	err = SetRecursive(filepath.Join(root, "missing"), FromUnix(0644), nil, nil)
+	if errs, ok := err.(MultiError); !ok || len(errs) != 1 || !os.IsNotExist(errs[0].(*os.PathError).Err) {
+		t.Errorf("unexpected error: want single not-exist error; got %v", err)
+	}
+}
+
+func TestAddRecursiveNoMaskRecalc(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	file := filepath.Join(root, "file")
+	testutil.Must(t, ioutil.WriteFile(file, nil, 0600))
+
+	before := ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagMask, "", 4}, {TagOther, "", 0}}
+	for i, test := range []struct {
+		opts WalkOptions
+		want ACL
+	}{
+		// setfacl -R -m g::x
+		{
+			WalkOptions{},
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagMask, "", 5}, {TagOther, "", 0}},
+		},
+		// setfacl -R -n -m g::x
+		{
+			WalkOptions{NoMaskRecalc: true},
+			ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 1}, {TagMask, "", 4}, {TagOther, "", 0}},
+		},
+	} {
+		testutil.Must(t, SetRecursive(root, before, before, nil))
+		opts := test.opts
+		testutil.Must(t, AddRecursive(root, []Entry{{TagGroupObj, "", 1}}, []Entry{{TagGroupObj, "", 1}}, &opts))
+		for _, path := range []string{root, file} {
+			acl, err := Get(path)
+			testutil.Must(t, err)
+			if !reflect.DeepEqual(acl, test.want) {
+				t.Errorf("case %v: unexpected ACL for %v: want %v; got %v", i, path, test.want, acl)
+			}
+		}
+		dacl, err := GetDefault(root)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(dacl, test.want) {
+			t.Errorf("case %v: unexpected default ACL: want %v; got %v", i, test.want, dacl)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"fmt"
+	"sync"
+)
+
+// A Resolver translates between numeric user and group IDs
+// and user and group names. Resolvers are used to print names
+// in the text forms of ACLs and to resolve names when parsing
+// them. Functions which don't take a Resolver use the system's
+// user and group database (see OSResolver).
+type Resolver interface {
+	// UserName returns the name of the user with the given UID.
+	UserName(uid UID) (string, error)
+	// GroupName returns the name of the group with the given GID.
+	GroupName(gid GID) (string, error)
+	// LookupUser returns the UID of the user with the given name.
+	LookupUser(name string) (UID, error)
+	// LookupGroup returns the GID of the group with the given name.
+	LookupGroup(name string) (GID, error)
+}
+
+// overwrite in other files to implement platform-specific behavior
+var defaultResolver Resolver = NumericResolver{}
+
+// NumericResolver is a Resolver which knows no names. When
+// it is used for formatting, ACLs are printed with numeric
+// IDs (like getfacl -n); when it is used for parsing, only
+// numeric IDs are accepted.
+type NumericResolver struct{}
+
+// UserName always returns an error.
+func (NumericResolver) UserName(uid UID) (string, error) {
+	return "", fmt.Errorf("unknown user %d", uid)
+}
+
+// GroupName always returns an error.
+func (NumericResolver) GroupName(gid GID) (string, error) {
+	return "", fmt.Errorf("unknown group %d", gid)
+}
+
+// LookupUser always returns an error.
+func (NumericResolver) LookupUser(name string) (UID, error) {
+	return 0, fmt.Errorf("unknown user %q", name)
+}
+
+// LookupGroup always returns an error.
+func (NumericResolver) LookupGroup(name string) (GID, error) {
+	return 0, fmt.Errorf("unknown group %q", name)
+}
+
+// NewCachingResolver returns a Resolver which caches the
+// results of r, including failed lookups. It is safe for
+// concurrent use if r is.
+func NewCachingResolver(r Resolver) Resolver {
+	return &cachingResolver{
+		r:      r,
+		users:  make(map[UID]cachedName),
+		groups: make(map[GID]cachedName),
+		uids:   make(map[string]cachedID),
+		gids:   make(map[string]cachedID),
+	}
+}
+
+type cachedName struct {
+	name string
+	err  error
+}
+
+type cachedID struct {
+	id  uint32
+	err error
+}
+
+type cachingResolver struct {
+	r      Resolver
+	mu     sync.Mutex
+	users  map[UID]cachedName
+	groups map[GID]cachedName
+	uids   map[string]cachedID
+	gids   map[string]cachedID
+}
+
+func (c *cachingResolver) UserName(uid UID) (string, error) {
+	c.mu.Lock()
+	res, ok := c.users[uid]
+	c.mu.Unlock()
+	if !ok {
+		res.name, res.err = c.r.UserName(uid)
+		c.mu.Lock()
+		c.users[uid] = res
+		c.mu.Unlock()
+	}
+	return res.name, res.err
+}
+
+func (c *cachingResolver) GroupName(gid GID) (string, error) {
+	c.mu.Lock()
+	res, ok := c.groups[gid]
+	c.mu.Unlock()
+	if !ok {
+		res.name, res.err = c.r.GroupName(gid)
+		c.mu.Lock()
+		c.groups[gid] = res
+		c.mu.Unlock()
+	}
+	return res.name, res.err
+}
+
+func (c *cachingResolver) LookupUser(name string) (UID, error) {
+	c.mu.Lock()
+	res, ok := c.uids[name]
+	c.mu.Unlock()
+	if !ok {
+		var uid UID
+		uid, res.err = c.r.LookupUser(name)
+		res.id = uint32(uid)
+		c.mu.Lock()
+		c.uids[name] = res
+		c.mu.Unlock()
+	}
+	return UID(res.id), res.err
+}
+
+func (c *cachingResolver) LookupGroup(name string) (GID, error) {
+	c.mu.Lock()
+	res, ok := c.gids[name]
+	c.mu.Unlock()
+	if !ok {
+		var gid GID
+		gid, res.err = c.r.LookupGroup(name)
+		res.id = uint32(gid)
+		c.mu.Lock()
+		c.gids[name] = res
+		c.mu.Unlock()
+	}
+	return GID(res.id), res.err
+}
+
+// formatQualifier returns the name of the user or group
+// identified by the qualifier q, or q itself if q is not
+// a numeric ID or the lookup fails.
+func formatQualifier(r Resolver, q string, tag Tag) string {
+	id, ok := ParseQualifier(q).ID()
+	if !ok {
+		return q
+	}
+	var name string
+	var err error
+	switch tag {
+	case TagUser:
+		name, err = r.UserName(UID(id))
+	case TagGroup:
+		name, err = r.GroupName(GID(id))
+	default:
+		return q
+	}
+	if err != nil {
+		return q
+	}
+	return name
+}
+
+// lookupQualifier returns the ID of the user
+// or group with the given name.
+func lookupQualifier(r Resolver, name string, tag Tag) (uint32, error) {
+	switch tag {
+	case TagUser:
+		uid, err := r.LookupUser(name)
+		return uint32(uid), err
+	case TagGroup:
+		gid, err := r.LookupGroup(name)
+		return uint32(gid), err
+	default:
+		return 0, fmt.Errorf("cannot resolve qualifier %q for tag %s", name, tag.StringLong())
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileResolver is a Resolver which reads users and groups
+// from the etc/passwd and etc/group files beneath a root
+// directory rather than from the system's user and group
+// database. It is useful for inspecting the files of a
+// container image or a mounted disk image, whose users
+// and groups may differ from those of the host.
+//
+// The files are read lazily and re-read whenever their
+// modification time or size changes. A missing file is
+// treated as empty. Symbolic links are not followed while
+// resolving the paths of the files, so that a link to the
+// host's /etc/passwd, for example, is never read; lookups
+// fail with an error instead, as they do if either file is
+// not a regular file (such as a FIFO, which could otherwise
+// block lookups forever). A FileResolver is safe for
+// concurrent use.
+type FileResolver struct {
+	mu     sync.Mutex
+	passwd idFile
+	group  idFile
+}
+
+// NewFileResolver returns a FileResolver which reads
+// root/etc/passwd and root/etc/group.
+func NewFileResolver(root string) *FileResolver {
+	return &FileResolver{
+		passwd: idFile{root: root, name: filepath.Join("etc", "passwd"), idField: 2},
+		group:  idFile{root: root, name: filepath.Join("etc", "group"), idField: 2},
+	}
+}
+
+// UserName implements Resolver.
+func (r *FileResolver) UserName(uid UID) (string, error) {
+	name, ok, err := r.lookupID(&r.passwd, uint32(uid))
+	if err == nil && !ok {
+		err = fmt.Errorf("unknown user %d", uid)
+	}
+	return name, err
+}
+
+// GroupName implements Resolver.
+func (r *FileResolver) GroupName(gid GID) (string, error) {
+	name, ok, err := r.lookupID(&r.group, uint32(gid))
+	if err == nil && !ok {
+		err = fmt.Errorf("unknown group %d", gid)
+	}
+	return name, err
+}
+
+// LookupUser implements Resolver.
+func (r *FileResolver) LookupUser(name string) (UID, error) {
+	id, ok, err := r.lookupName(&r.passwd, name)
+	if err == nil && !ok {
+		err = fmt.Errorf("unknown user %q", name)
+	}
+	return UID(id), err
+}
+
+// LookupGroup implements Resolver.
+func (r *FileResolver) LookupGroup(name string) (GID, error) {
+	id, ok, err := r.lookupName(&r.group, name)
+	if err == nil && !ok {
+		err = fmt.Errorf("unknown group %q", name)
+	}
+	return GID(id), err
+}
+
+func (r *FileResolver) lookupID(f *idFile, id uint32) (name string, ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := f.reload(); err != nil {
+		return "", false, err
+	}
+	name, ok = f.names[id]
+	return name, ok, nil
+}
+
+func (r *FileResolver) lookupName(f *idFile, name string) (id uint32, ok bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := f.reload(); err != nil {
+		return 0, false, err
+	}
+	id, ok = f.ids[name]
+	return id, ok, nil
+}
+
+// errNotRegular is returned when a passwd or
+// group file is not a regular file.
+var errNotRegular = errors.New("not a regular file")
+
+// checkRegular returns an error if f is not a regular file.
+func checkRegular(f *os.File) error {
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return &os.PathError{Op: "open", Path: f.Name(), Err: errNotRegular}
+	}
+	return nil
+}
+
+// idFile is the parsed contents of a passwd or group file.
+type idFile struct {
+	root    string
+	name    string // relative to root
+	idField int    // index of the ID in each colon-separated line
+
+	loaded  bool
+	modTime time.Time
+	size    int64
+	names   map[uint32]string
+	ids     map[string]uint32
+}
+
+// reload re-reads the file if it has changed
+// since it was last read.
+func (f *idFile) reload() error {
+	file, err := openFileBeneath(f.root, f.name)
+	if os.IsNotExist(err) {
+		f.loaded = false
+		f.names, f.ids = nil, nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	fi, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if f.loaded && fi.ModTime().Equal(f.modTime) && fi.Size() == f.size {
+		return nil
+	}
+
+	names := make(map[uint32]string)
+	ids := make(map[string]uint32)
+	s := bufio.NewScanner(file)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			// skip comments and NIS compat entries
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) <= f.idField || fields[0] == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(fields[f.idField], 10, 32)
+		if err != nil {
+			continue
+		}
+		// like getpwnam and getpwuid, the
+		// first matching entry wins
+		if _, ok := names[uint32(id)]; !ok {
+			names[uint32(id)] = fields[0]
+		}
+		if _, ok := ids[fields[0]]; !ok {
+			ids[fields[0]] = uint32(id)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	f.loaded = true
+	f.modTime = fi.ModTime()
+	f.size = fi.Size()
+	f.names, f.ids = names, ids
+	return nil
+}
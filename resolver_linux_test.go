@@ -0,0 +1,68 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joshlf/testutil"
+	"golang.org/x/sys/unix"
+)
+
+func TestFileResolverFIFO(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "etc"), 0755))
+	testutil.Must(t, unix.Mkfifo(filepath.Join(root, "etc", "passwd"), 0644))
+
+	// this would block forever if the FIFO were opened
+	// without O_NONBLOCK and read
+	r := NewFileResolver(root)
+	if name, err := r.UserName(0); err == nil {
+		t.Errorf("unexpected result looking up user in FIFO: %v", name)
+	}
+}
+
+func TestOpenFileBeneath(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "etc"), 0755))
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "dir"), 0755))
+	f := testutil.MustTempFile(t, filepath.Join(root, "etc"), "acl")
+	f.Close()
+	name := filepath.Join("etc", filepath.Base(f.Name()))
+	testutil.Must(t, os.Symlink(filepath.Base(f.Name()), filepath.Join(root, "etc", "link")))
+	testutil.Must(t, os.Symlink("etc", filepath.Join(root, "etclink")))
+
+	for _, test := range []struct {
+		name string
+		err  error
+	}{
+		{name, nil},
+		{"etc/link", unix.ELOOP},
+		{"etclink/" + filepath.Base(f.Name()), unix.ENOTDIR},
+		{"etc/missing", unix.ENOENT},
+		{"dir", errNotRegular},
+	} {
+		f, err := openFileBeneath(root, test.name)
+		if err == nil {
+			f.Close()
+		}
+		var got error
+		if pe, ok := err.(*os.PathError); ok {
+			got = pe.Err
+			if se, ok := got.(*sysError); ok {
+				got = se.err
+			}
+		}
+		if (err == nil) != (test.err == nil) || (err != nil && got != test.err) {
+			t.Errorf("%v: unexpected error: want %v; got %v", test.name, test.err, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+// testResolver knows a single user and group, and
+// counts the number of lookups performed.
+type testResolver struct {
+	lookups int
+}
+
+func (t *testResolver) UserName(uid UID) (string, error) {
+	t.lookups++
+	if uid == 1000 {
+		return "dvader", nil
+	}
+	return "", fmt.Errorf("unknown user %d", uid)
+}
+
+func (t *testResolver) GroupName(gid GID) (string, error) {
+	t.lookups++
+	if gid == 2000 {
+		return "empire", nil
+	}
+	return "", fmt.Errorf("unknown group %d", gid)
+}
+
+func (t *testResolver) LookupUser(name string) (UID, error) {
+	t.lookups++
+	if name == "dvader" {
+		return 1000, nil
+	}
+	return 0, fmt.Errorf("unknown user %q", name)
+}
+
+func (t *testResolver) LookupGroup(name string) (GID, error) {
+	t.lookups++
+	if name == "empire" {
+		return 2000, nil
+	}
+	return 0, fmt.Errorf("unknown group %q", name)
+}
+
+func TestResolver(t *testing.T) {
+	acl := ACL{{TagUserObj, "", 7}, {TagUser, "1000", 4}, {TagUser, "1001", 4},
+		{TagGroupObj, "", 5}, {TagGroup, "2000", 1}, {TagMask, "", 5}, {TagOther, "", 0}}
+	r := &testResolver{}
+
+	text := acl.StringWith(r)
+	want := "u::rwx,u:dvader:r--,u:1001:r--,g::r-x,g:empire:--x,m::r-x,o::---"
+	if text != want {
+		t.Errorf("unexpected text: want %v; got %v", want, text)
+	}
+	acl2, err := ParseWith(text, r)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(acl, acl2) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, acl2)
+	}
+	if _, err := ParseWith("u:dvader:r--", NumericResolver{}); err == nil {
+		t.Errorf("expected error parsing name with NumericResolver")
+	}
+	want = "u::rwx,u:1000:r--,u:1001:r--,g::r-x,g:2000:--x,m::r-x,o::---"
+	if text := acl.StringWith(NumericResolver{}); text != want {
+		t.Errorf("unexpected text: want %v; got %v", want, text)
+	}
+
+	// Make sure that lookups (including failed ones)
+	// are only performed once by a caching resolver
+	r = &testResolver{}
+	c := NewCachingResolver(r)
+	for i := 0; i < 3; i++ {
+		acl.StringWith(c)
+		ParseWith(text, c)
+	}
+	if r.lookups != 5 {
+		t.Errorf("unexpected number of lookups: want 5; got %v", r.lookups)
+	}
+}
+
+func TestRemoveWith(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.Remove(d)
+
+	acl := append(ACL{{TagUser, "1000", 4}, {TagGroup, "2000", 1}, {TagMask, "", 5}}, base...)
+	want := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "2000", 1}, {TagMask, "", 1}, {TagOther, "", 0}}
+	r := &testResolver{}
+	testutil.Must(t, Set(f, acl))
+	testutil.Must(t, RemoveWith(f, r, Key{TagUser, "dvader"}))
+	got, err := Get(f)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, got)
+	}
+	testutil.Must(t, SetDefault(d, acl))
+	testutil.Must(t, RemoveFromDefaultWith(d, r, Key{TagUser, "dvader"}))
+	got, err = GetDefault(d)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected default ACL: want %v; got %v", want, got)
+	}
+
+	if err := RemoveWith(f, NumericResolver{}, Key{TagGroup, "empire"}); err == nil {
+		t.Errorf("expected error removing name with NumericResolver")
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	root := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(root)
+	testutil.Must(t, os.Mkdir(filepath.Join(root, "etc"), 0755))
+	passwd := filepath.Join(root, "etc", "passwd")
+	testutil.Must(t, ioutil.WriteFile(passwd, []byte(`# comment
+root:x:0:0:root:/root:/bin/sh
+dvader:x:1000:1000::/home/dvader:/bin/sh
++nis
+dvader2:x:1000:1000::/home/dvader:/bin/sh
+`), 0644))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(root, "etc", "group"), []byte(`root:x:0:
+empire:x:2000:dvader
+`), 0644))
+
+	r := NewFileResolver(root)
+	acl := ACL{{TagUser, "1000", 4}, {TagUser, "1001", 4}, {TagGroup, "2000", 1}}
+	want := "u:dvader:r--,u:1001:r--,g:empire:--x"
+	if text := acl.StringWith(r); text != want {
+		t.Errorf("unexpected text: want %v; got %v", want, text)
+	}
+	if uid, err := r.LookupUser("dvader2"); err != nil || uid != 1000 {
+		t.Errorf("unexpected result: want 1000; got %v (error: %v)", uid, err)
+	}
+	if _, err := r.LookupGroup("rebels"); err == nil {
+		t.Errorf("expected error looking up unknown group")
+	}
+
+	// Make sure changes are picked up
+	testutil.Must(t, ioutil.WriteFile(passwd, []byte("lskywalker:x:1000:1000::/:/bin/sh\n"), 0644))
+	if name, err := r.UserName(1000); err != nil || name != "lskywalker" {
+		t.Errorf("unexpected result: want lskywalker; got %v (error: %v)", name, err)
+	}
+	testutil.Must(t, os.Remove(passwd))
+	if _, err := r.UserName(1000); err == nil {
+		t.Errorf("expected error looking up user after removing passwd file")
+	}
+
+	// Make sure symbolic links out of root aren't followed
+	testutil.Must(t, os.Symlink("/etc/passwd", passwd))
+	if name, err := r.UserName(0); err == nil {
+		t.Errorf("unexpected result looking up user through symlink: %v", name)
+	}
+	testutil.Must(t, os.Remove(passwd))
+	testutil.Must(t, os.Rename(filepath.Join(root, "etc"), filepath.Join(root, "etc.old")))
+	testutil.Must(t, os.Symlink("/etc", filepath.Join(root, "etc")))
+	if name, err := r.UserName(0); err == nil {
+		t.Errorf("unexpected result looking up user through symlinked directory: %v", name)
+	}
+}
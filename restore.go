@@ -0,0 +1,178 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MultiError collects the errors encountered by operations
+// which act on many files, such as Restore. These operations
+// continue after an error on an individual file, and each
+// error records the path that caused it (usually as an
+// *os.PathError).
+type MultiError []error
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "no errors"
+	case 1:
+		return m[0].Error()
+	default:
+		return fmt.Sprintf("%v (and %d more errors)", m[0], len(m)-1)
+	}
+}
+
+// RestoreOptions configures the behavior of Restore.
+type RestoreOptions struct {
+	// If Owner is true, the owner and group of each file
+	// are restored from the "# owner:" and "# group:"
+	// headers. This usually requires privileges.
+	Owner bool
+
+	// If Dir is non-empty, relative paths are interpreted
+	// relative to Dir rather than to the current directory.
+	Dir string
+
+	// Resolver is used to resolve user and group names in
+	// entries and headers. If it is nil, the system's user
+	// and group database is used.
+	Resolver Resolver
+}
+
+// Restore reads ACLs in the format produced by getfacl
+// (see Decoder) from r, and applies them to the files named
+// by the "# file:" headers, like setfacl --restore. For
+// each file, the access ACL is set with Set. For directories,
+// the default ACL is set with SetDefault, or removed if the
+// input contains no default entries for the directory.
+// Special mode bits from the "# flags:" header are also
+// applied. opts may be nil, in which case the defaults are
+// used.
+//
+// An error on one file does not prevent the remaining files
+// from being restored. If any errors occur, Restore returns
+// a MultiError containing an *os.PathError for each file that
+// failed. A syntax error in the input stops the restore, and
+// is included in the MultiError.
+func Restore(r io.Reader, opts *RestoreOptions) error {
+	return FS{Backend: OSBackend}.Restore(r, opts)
+}
+
+// Restore reads ACLs in the format produced by getfacl
+// from r and applies them to the files of fs like the
+// package-level Restore.
+func (fs FS) Restore(r io.Reader, opts *RestoreOptions) error {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+	res := opts.Resolver
+	if res == nil {
+		res = defaultResolver
+	}
+	var errs MultiError
+	d := NewDecoder(r)
+	d.Resolver = res
+	for {
+		fa, err := d.Decode()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err)
+			break
+		}
+		path := fa.Path
+		if path == "" {
+			errs = append(errs, errors.New("missing file header"))
+			continue
+		}
+		if opts.Dir != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(opts.Dir, path)
+		}
+		if err := fs.restore(path, fa, opts.Owner, res); err != nil {
+			errs = append(errs, pathError("restore", path, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func (fs FS) restore(path string, fa *FileACL, owner bool, r Resolver) error {
+	if owner && (fa.Owner != "" || fa.Group != "") {
+		uid, gid := -1, -1
+		if fa.Owner != "" {
+			id, err := lookupID(r, fa.Owner, TagUser)
+			if err != nil {
+				return err
+			}
+			uid = id
+		}
+		if fa.Group != "" {
+			id, err := lookupID(r, fa.Group, TagGroup)
+			if err != nil {
+				return err
+			}
+			gid = id
+		}
+		if err := fs.Backend.Chown(path, uid, gid); err != nil {
+			return err
+		}
+	}
+
+	fi, err := fs.Backend.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fa.Access != nil {
+		if err := fa.Access.Validate(); err != nil {
+			return err
+		}
+		if err := setType(fs.file(path), aclEAAccess, fa.Access); err != nil {
+			return err
+		}
+	}
+	if fi.IsDir() {
+		if fa.Default == nil {
+			err = fs.RemoveDefault(path)
+		} else if err = fa.Default.Validate(); err == nil {
+			err = setType(fs.file(path), aclEADefault, fa.Default)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// chown and setting the ACL may have cleared the
+	// setuid and setgid bits, so fetch the mode again
+	if fi, err = fs.Backend.Stat(path); err != nil {
+		return err
+	}
+	const special = os.ModeSetuid | os.ModeSetgid | os.ModeSticky
+	if fi.Mode()&special != fa.Flags {
+		return fs.Backend.Chmod(path, fi.Mode()&^special|fa.Flags)
+	}
+	return nil
+}
+
+// lookupID resolves a user or group name or numeric ID,
+// as found in the "# owner:" and "# group:" headers.
+func lookupID(r Resolver, name string, tag Tag) (int, error) {
+	q, err := ParseQualifier(name).ResolveWith(tag, r)
+	if err != nil {
+		return 0, err
+	}
+	id, _ := q.ID()
+	return int(id), nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestDecoder(t *testing.T) {
+	text := `
+# file: a
+user::rw-
+group::r--
+other::---
+# file: b
+user::rwx
+group::---
+other::---
+
+# file: c
+user::r-x
+group::---
+othr::---
+`
+	d := NewDecoder(strings.NewReader(text))
+	for _, path := range []string{"a", "b"} {
+		fa, err := d.Decode()
+		testutil.Must(t, err)
+		if fa.Path != path {
+			t.Errorf("unexpected path: want %v; got %v", path, fa.Path)
+		}
+	}
+	_, err := d.Decode()
+	serr, ok := err.(*SyntaxError)
+	if !ok || serr.Line != 14 || serr.Offset != len(text)-len("othr::---\n") {
+		t.Errorf("unexpected error: want syntax error on line 14; got %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	f := filepath.Join(d, "file")
+	testutil.Must(t, ioutil.WriteFile(f, nil, 0644))
+
+	text := `# file: .
+# flags: --t
+user::rwx
+group::r-x
+other::r-x
+default:user::rwx
+default:user:0:r--
+default:group::r-x
+default:mask::r--
+default:other::---
+
+# file: missing
+user::rwx
+group::r-x
+other::r-x
+
+# file: file
+user::rw-
+user:0:rwx
+group::r--
+mask::rwx
+other::---
+`
+	err := Restore(strings.NewReader(text), &RestoreOptions{Dir: d})
+	errs, ok := err.(MultiError)
+	if !ok || len(errs) != 1 || !os.IsNotExist(errs[0].(*os.PathError).Err) {
+		t.Errorf("unexpected error: want single error for missing file; got %v", err)
+	}
+
+	acl, err := Get(f)
+	testutil.Must(t, err)
+	want := ACL{{TagUserObj, "", 6}, {TagUser, "0", 7}, {TagGroupObj, "", 4},
+		{TagMask, "", 7}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(acl, want) {
+		t.Errorf("unexpected ACL: want %v; got %v", want, acl)
+	}
+	dacl, err := GetDefault(d)
+	testutil.Must(t, err)
+	want = ACL{{TagUserObj, "", 7}, {TagUser, "0", 4}, {TagGroupObj, "", 5},
+		{TagMask, "", 4}, {TagOther, "", 0}}
+	if !reflect.DeepEqual(dacl, want) {
+		t.Errorf("unexpected default ACL: want %v; got %v", want, dacl)
+	}
+	fi, err := os.Stat(d)
+	testutil.Must(t, err)
+	if fi.Mode()&os.ModeSticky == 0 {
+		t.Errorf("sticky bit not restored: mode %v", fi.Mode())
+	}
+
+	// Restoring a directory without default entries
+	// should remove its default ACL
+	err = Restore(strings.NewReader("# file: .\nuser::rwx\ngroup::r-x\nother::r-x\n"),
+		&RestoreOptions{Dir: d})
+	testutil.Must(t, err)
+	dacl, err = GetDefault(d)
+	testutil.Must(t, err)
+	if dacl != nil {
+		t.Errorf("unexpected default ACL: want none; got %v", dacl)
+	}
+}
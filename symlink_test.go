@@ -0,0 +1,90 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestSymlink(t *testing.T) {
+	d := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(d)
+	target := filepath.Join(d, "target")
+	testutil.Must(t, ioutil.WriteFile(target, nil, 0600))
+	link := filepath.Join(d, "link")
+	testutil.Must(t, os.Symlink(target, link))
+	dirLink := filepath.Join(d, "dirlink")
+	testutil.Must(t, os.Symlink(d, dirLink))
+
+	acl := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 0}, {TagMask, "", 4}, {TagOther, "", 0}}
+	testutil.Must(t, LSet(target, acl))
+	got, err := LGet(target)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+
+	if _, err := LGet(link); !isSymlinkError(err) {
+		t.Errorf("unexpected error from LGet: want ErrSymlink; got %v", err)
+	}
+	if _, err := LGetDefault(dirLink); !isSymlinkError(err) {
+		t.Errorf("unexpected error from LGetDefault: want ErrSymlink; got %v", err)
+	}
+	if err := LSet(link, base); !isSymlinkError(err) {
+		t.Errorf("unexpected error from LSet: want ErrSymlink; got %v", err)
+	}
+	if err := LSetDefault(dirLink, base); !isSymlinkError(err) {
+		t.Errorf("unexpected error from LSetDefault: want ErrSymlink; got %v", err)
+	}
+	// the target must not have been modified through the link
+	got, err = Get(target)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+
+	// with NoFollow, the walk doesn't follow the
+	// root, and doesn't descend through dirlink
+	err = SetRecursive(dirLink, base, nil, &WalkOptions{Mode: WalkLogical, NoFollow: true})
+	testutil.Must(t, err)
+	err = SetRecursive(d, nil, base, &WalkOptions{Mode: WalkLogical, NoFollow: true})
+	testutil.Must(t, err)
+	got, err = Get(target)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(got, acl) {
+		t.Errorf("unexpected ACL: want %v; got %v", acl, got)
+	}
+	def, err := GetDefault(d)
+	testutil.Must(t, err)
+	if !reflect.DeepEqual(def, base) {
+		t.Errorf("unexpected default ACL: want %v; got %v", base, def)
+	}
+}
+
+// isSymlinkError returns whether err is an
+// *os.PathError matching ErrSymlink.
+func isSymlinkError(err error) bool {
+	return isSentinelError(err, ErrSymlink)
+}
+
+// isSentinelError returns whether err is an *os.PathError
+// matching the sentinel error. It doesn't use errors.Is so
+// that it can be used on all supported Go versions.
+func isSentinelError(err, sentinel error) bool {
+	pe, ok := err.(*os.PathError)
+	if !ok {
+		return false
+	}
+	se, ok := pe.Err.(*sysError)
+	return ok && se.sentinel == sentinel
+}
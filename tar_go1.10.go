@@ -0,0 +1,164 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build go1.10
+
+package acl
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The PAX records in which GNU tar, bsdtar, and star
+// store the access and default ACLs of a file.
+const (
+	PAXRecordAccess  = "SCHILY.acl.access"
+	PAXRecordDefault = "SCHILY.acl.default"
+)
+
+// SetTarHeaderACLs stores access and def in the PAX records
+// of hdr in the format written by GNU tar: the long text
+// form, with one entry per line and user and group names
+// where they can be resolved. As GNU tar does, the access
+// ACL is only stored if it has named user or group entries
+// or a mask entry, since otherwise it is equivalent to the
+// mode in hdr. If an ACL is not stored, any existing record
+// for it is removed.
+func SetTarHeaderACLs(hdr *tar.Header, access, def ACL) {
+	if hdr.PAXRecords == nil {
+		hdr.PAXRecords = make(map[string]string)
+	}
+	if len(access.minimal()) != len(access) {
+		hdr.PAXRecords[PAXRecordAccess] = formatTarACL(access)
+	} else {
+		delete(hdr.PAXRecords, PAXRecordAccess)
+	}
+	if def != nil {
+		hdr.PAXRecords[PAXRecordDefault] = formatTarACL(def)
+	} else {
+		delete(hdr.PAXRecords, PAXRecordDefault)
+	}
+}
+
+func formatTarACL(a ACL) string {
+	var b strings.Builder
+	for _, e := range a {
+		b.WriteString(e.StringLongWith(defaultResolver))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// TarHeaderACLs parses the ACLs stored in the PAX records of
+// hdr. Entries may be separated by commas or newlines, may be
+// followed by comments, and may have a fourth field holding
+// the numeric ID of a named user or group (as written by star
+// and bsdtar), which is used if the name can't be resolved.
+// If hdr has no record for an ACL, that ACL is nil.
+func TarHeaderACLs(hdr *tar.Header) (access, def ACL, err error) {
+	if text, ok := hdr.PAXRecords[PAXRecordAccess]; ok {
+		if access, err = parseTarACL(text); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", PAXRecordAccess, err)
+		}
+	}
+	if text, ok := hdr.PAXRecords[PAXRecordDefault]; ok {
+		if def, err = parseTarACL(text); err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", PAXRecordDefault, err)
+		}
+	}
+	return access, def, nil
+}
+
+func parseTarACL(s string) (ACL, error) {
+	var acl ACL
+	for _, line := range strings.Split(s, "\n") {
+		if i := strings.IndexByte(line, '#'); i != -1 {
+			line = line[:i]
+		}
+		for _, text := range strings.Split(line, ",") {
+			if strings.TrimSpace(text) == "" {
+				continue
+			}
+			var id string
+			if fields := strings.Split(text, ":"); len(fields) == 4 {
+				text, id = strings.Join(fields[:3], ":"), strings.TrimSpace(fields[3])
+			}
+			e, err := ParseEntry(text)
+			if err != nil && id != "" {
+				if _, perr := strconv.ParseUint(id, 10, 32); perr == nil {
+					// fall back to the numeric ID if
+					// the name can't be resolved
+					fields := strings.Split(text, ":")
+					fields[1] = id
+					e, err = ParseEntry(strings.Join(fields, ":"))
+				}
+			}
+			if err != nil {
+				return nil, err
+			}
+			acl = append(acl, e)
+		}
+	}
+	return acl, nil
+}
+
+// PopulateTarHeader stores the ACLs of path in the PAX
+// records of hdr as by SetTarHeaderACLs. hdr is usually
+// created from path by tar.FileInfoHeader. Symbolic links
+// and hard links have no ACLs of their own, so nothing is
+// stored for headers of these types.
+func PopulateTarHeader(hdr *tar.Header, path string) error {
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+		return nil
+	}
+	access, err := Get(path)
+	if err != nil {
+		return err
+	}
+	var def ACL
+	if hdr.Typeflag == tar.TypeDir {
+		if def, err = GetDefault(path); err != nil {
+			return err
+		}
+	}
+	SetTarHeaderACLs(hdr, access, def)
+	return nil
+}
+
+// ApplyTarHeader sets the ACLs stored in the PAX records of
+// hdr on path, which is usually the file just extracted from
+// hdr. If hdr has no access ACL record, the access ACL of path
+// is set to the minimal ACL equivalent to the mode in hdr,
+// replacing any ACL inherited from the parent directory. The
+// default ACL is only set if hdr is a directory, in which case
+// it is removed if hdr has no default ACL record. Nothing is
+// done for symbolic links and hard links.
+func ApplyTarHeader(hdr *tar.Header, path string) error {
+	if hdr.Typeflag == tar.TypeSymlink || hdr.Typeflag == tar.TypeLink {
+		return nil
+	}
+	access, def, err := TarHeaderACLs(hdr)
+	if err != nil {
+		return pathError("untar", path, err)
+	}
+	if access == nil {
+		access = FromUnix(os.FileMode(hdr.Mode))
+	}
+	if err := Set(path, access); err != nil {
+		return err
+	}
+	if hdr.Typeflag != tar.TypeDir {
+		return nil
+	}
+	if def == nil {
+		return RemoveDefault(path)
+	}
+	return SetDefault(path, def)
+}
@@ -0,0 +1,256 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+// +build go1.10
+
+package acl
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestTarHeaderACLs(t *testing.T) {
+	for i, test := range []struct {
+		records      map[string]string
+		access, def  ACL
+		errorOnParse bool
+	}{
+		// GNU tar
+		{
+			map[string]string{
+				PAXRecordAccess:  "user::rw-\nuser:0:r--\ngroup::r--\nmask::r--\nother::---\n",
+				PAXRecordDefault: "user::rwx\ngroup::r-x\nother::r-x\n",
+			},
+			ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}},
+			ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 5}, {TagOther, "", 5}},
+			false,
+		},
+		// star and bsdtar, falling back to the numeric ID
+		{
+			map[string]string{
+				PAXRecordAccess: "user::rw-,user:no such user:r--:1234,group::r--,group:0:rw-:0,mask::rw-,other::---",
+			},
+			ACL{{TagUserObj, "", 6}, {TagUser, "1234", 4}, {TagGroupObj, "", 4}, {TagGroup, "0", 6}, {TagMask, "", 6}, {TagOther, "", 0}},
+			nil,
+			false,
+		},
+		{
+			map[string]string{PAXRecordDefault: "user::rw-,bogus"},
+			nil, nil,
+			true,
+		},
+		{nil, nil, nil, false},
+	} {
+		access, def, err := TarHeaderACLs(&tar.Header{PAXRecords: test.records})
+		if (err != nil) != test.errorOnParse {
+			t.Errorf("%v: unexpected error: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(access, test.access) || !reflect.DeepEqual(def, test.def) {
+			t.Errorf("%v: unexpected ACLs: want %v and %v; got %v and %v", i, test.access, test.def, access, def)
+		}
+	}
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	src := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(src)
+	dst := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(dst)
+
+	access := ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 0}, {TagMask, "", 5}, {TagOther, "", 0}}
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "0", 1}, {TagMask, "", 1}, {TagOther, "", 0}}
+	fileACL := ACL{{TagUserObj, "", 6}, {TagGroupObj, "", 4}, {TagOther, "", 4}}
+	testutil.Must(t, os.Mkdir(filepath.Join(src, "dir"), 0755))
+	testutil.Must(t, Set(filepath.Join(src, "dir"), access))
+	testutil.Must(t, SetDefault(filepath.Join(src, "dir"), def))
+	f, err := os.Create(filepath.Join(src, "dir", "file"))
+	testutil.Must(t, err)
+	f.Close()
+	testutil.Must(t, Set(filepath.Join(src, "dir", "file"), fileACL))
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"dir", "dir/file"} {
+		path := filepath.Join(src, name)
+		fi, err := os.Stat(path)
+		testutil.Must(t, err)
+		hdr, err := tar.FileInfoHeader(fi, "")
+		testutil.Must(t, err)
+		hdr.Name = name
+		testutil.Must(t, PopulateTarHeader(hdr, path))
+		testutil.Must(t, tw.WriteHeader(hdr))
+	}
+	testutil.Must(t, tw.Close())
+
+	tr := tar.NewReader(&buf)
+	for _, name := range []string{"dir", "dir/file"} {
+		hdr, err := tr.Next()
+		testutil.Must(t, err)
+		path := filepath.Join(dst, hdr.Name)
+		if hdr.Typeflag == tar.TypeDir {
+			testutil.Must(t, os.Mkdir(path, 0700))
+		} else {
+			f, err := os.Create(path)
+			testutil.Must(t, err)
+			f.Close()
+		}
+		testutil.Must(t, ApplyTarHeader(hdr, path))
+
+		if name == "dir/file" {
+			if _, ok := hdr.PAXRecords[PAXRecordAccess]; ok {
+				t.Errorf("unexpected access ACL record for minimal ACL")
+			}
+		}
+	}
+
+	for _, test := range []struct {
+		name        string
+		access, def ACL
+	}{
+		{"dir", access, def},
+		{"dir/file", fileACL, nil},
+	} {
+		path := filepath.Join(dst, test.name)
+		got, err := Get(path)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(got, test.access) {
+			t.Errorf("%v: unexpected access ACL: want %v; got %v", test.name, test.access, got)
+		}
+		if test.def != nil {
+			got, err := GetDefault(path)
+			testutil.Must(t, err)
+			if !reflect.DeepEqual(got, test.def) {
+				t.Errorf("%v: unexpected default ACL: want %v; got %v", test.name, test.def, got)
+			}
+		}
+	}
+}
+
+// gnuTar skips the test unless GNU tar with
+// support for the --acls option is available.
+func gnuTar(t *testing.T) string {
+	path, err := exec.LookPath("tar")
+	if err != nil {
+		t.Skip("tar not found")
+	}
+	out, err := exec.Command(path, "--help").Output()
+	if err != nil || !bytes.Contains(out, []byte("--acls")) {
+		t.Skip("tar does not support --acls")
+	}
+	return path
+}
+
+func TestGNUTarInterop(t *testing.T) {
+	tarPath := gnuTar(t)
+	src := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(src)
+	dst := testutil.MustTempDir(t, "", "acl")
+	defer os.RemoveAll(dst)
+
+	access := ACL{{TagUserObj, "", 7}, {TagUser, "0", 5}, {TagGroupObj, "", 0}, {TagMask, "", 5}, {TagOther, "", 0}}
+	def := ACL{{TagUserObj, "", 7}, {TagGroupObj, "", 0}, {TagGroup, "0", 1}, {TagMask, "", 1}, {TagOther, "", 0}}
+	fileACL := ACL{{TagUserObj, "", 6}, {TagUser, "0", 4}, {TagGroupObj, "", 4}, {TagMask, "", 4}, {TagOther, "", 0}}
+	testutil.Must(t, os.Mkdir(filepath.Join(src, "dir"), 0755))
+	testutil.Must(t, Set(filepath.Join(src, "dir"), access))
+	testutil.Must(t, SetDefault(filepath.Join(src, "dir"), def))
+	testutil.Must(t, ioutil.WriteFile(filepath.Join(src, "dir", "file"), nil, 0644))
+	testutil.Must(t, Set(filepath.Join(src, "dir", "file"), fileACL))
+	want := map[string][2]ACL{
+		"dir":      {access, def},
+		"dir/file": {fileACL, nil},
+	}
+	check := func(root string) {
+		for name, acls := range want {
+			path := filepath.Join(root, name)
+			got, err := Get(path)
+			testutil.Must(t, err)
+			if !reflect.DeepEqual(got, acls[0]) {
+				t.Errorf("%v: unexpected access ACL: want %v; got %v", path, acls[0], got)
+			}
+			if acls[1] != nil {
+				got, err := GetDefault(path)
+				testutil.Must(t, err)
+				if !reflect.DeepEqual(got, acls[1]) {
+					t.Errorf("%v: unexpected default ACL: want %v; got %v", path, acls[1], got)
+				}
+			}
+		}
+	}
+
+	// Read an archive written by GNU tar
+	archive := filepath.Join(dst, "gnu.tar")
+	out, err := exec.Command(tarPath, "--acls", "--format=posix", "-cf", archive, "-C", src, "dir").CombinedOutput()
+	if err != nil {
+		t.Fatalf("tar failed: %v: %s", err, out)
+	}
+	f, err := os.Open(archive)
+	testutil.Must(t, err)
+	defer f.Close()
+	gnuDst := filepath.Join(dst, "gnu")
+	testutil.Must(t, os.Mkdir(gnuDst, 0755))
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		testutil.Must(t, err)
+		name := strings.TrimSuffix(hdr.Name, "/")
+		if _, ok := hdr.PAXRecords[PAXRecordAccess]; !ok {
+			t.Skip("tar did not store ACLs")
+		}
+		gotAccess, gotDef, err := TarHeaderACLs(hdr)
+		testutil.Must(t, err)
+		if !reflect.DeepEqual(gotAccess, want[name][0]) || !reflect.DeepEqual(gotDef, want[name][1]) {
+			t.Errorf("%v: unexpected ACLs: want %v and %v; got %v and %v", name, want[name][0], want[name][1], gotAccess, gotDef)
+		}
+		path := filepath.Join(gnuDst, name)
+		if hdr.Typeflag == tar.TypeDir {
+			testutil.Must(t, os.Mkdir(path, 0700))
+		} else {
+			testutil.Must(t, ioutil.WriteFile(path, nil, 0600))
+		}
+		testutil.Must(t, ApplyTarHeader(hdr, path))
+	}
+	check(gnuDst)
+
+	// Write an archive for GNU tar to extract
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"dir", "dir/file"} {
+		path := filepath.Join(src, name)
+		fi, err := os.Stat(path)
+		testutil.Must(t, err)
+		hdr, err := tar.FileInfoHeader(fi, "")
+		testutil.Must(t, err)
+		hdr.Name = name
+		hdr.Format = tar.FormatPAX
+		testutil.Must(t, PopulateTarHeader(hdr, path))
+		testutil.Must(t, tw.WriteHeader(hdr))
+	}
+	testutil.Must(t, tw.Close())
+	archive = filepath.Join(dst, "go.tar")
+	testutil.Must(t, ioutil.WriteFile(archive, buf.Bytes(), 0644))
+	goDst := filepath.Join(dst, "go")
+	testutil.Must(t, os.Mkdir(goDst, 0755))
+	out, err = exec.Command(tarPath, "--acls", "-xpf", archive, "-C", goDst).CombinedOutput()
+	if err != nil {
+		t.Fatalf("tar failed: %v: %s", err, out)
+	}
+	check(goDst)
+}
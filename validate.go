@@ -0,0 +1,157 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ViolationReason is the reason an ACL is invalid.
+type ViolationReason int
+
+const (
+	// A required entry is missing. This is either one of the
+	// TagUserObj, TagGroupObj, and TagOther entries, or the
+	// mask entry of an ACL with named user or group entries.
+	MissingEntry ViolationReason = iota + 1
+	// More than one entry has the same tag (and, for TagUser
+	// and TagGroup entries, the same qualifier).
+	DuplicateEntry
+	// An entry has a tag which is not one of those
+	// defined by this package.
+	UnknownTag
+)
+
+// Violation describes one way in which an ACL violates
+// the rules listed in the documentation for ACL.IsValid.
+type Violation struct {
+	Reason ViolationReason
+	// Tag is the tag of the missing or duplicated entry,
+	// or the unknown tag.
+	Tag Tag
+	// Qualifier is the qualifier of duplicated TagUser or
+	// TagGroup entries.
+	Qualifier string
+	// Entries holds the indices in the ACL of the offending
+	// entries. For a missing mask entry, these are the named
+	// entries which require it; for other missing entries,
+	// it is empty.
+	Entries []int
+}
+
+func (v Violation) String() string {
+	switch v.Reason {
+	case MissingEntry:
+		if v.Tag == TagMask {
+			return fmt.Sprintf("missing mask entry required by named %s", entriesString(v.Entries))
+		}
+		return fmt.Sprintf("missing %s entry", tagName(v.Tag))
+	case DuplicateEntry:
+		if v.Tag == TagUser || v.Tag == TagGroup {
+			return fmt.Sprintf("duplicate qualifier for %s %s (%s)", tagName(v.Tag), v.Qualifier, entriesString(v.Entries))
+		}
+		return fmt.Sprintf("duplicate %s entry (%s)", tagName(v.Tag), entriesString(v.Entries))
+	case UnknownTag:
+		return fmt.Sprintf("unknown %s (%s)", tagName(v.Tag), entriesString(v.Entries))
+	default:
+		return fmt.Sprintf("unknown violation %d", int(v.Reason))
+	}
+}
+
+// tagName returns the name used for t in error messages,
+// which distinguishes TagUserObj from TagUser and
+// TagGroupObj from TagGroup.
+func tagName(t Tag) string {
+	switch t {
+	case TagUserObj:
+		return "user_obj"
+	case TagGroupObj:
+		return "group_obj"
+	case TagUser, TagGroup, TagMask, TagOther:
+		return t.StringLong()
+	default:
+		return fmt.Sprintf("tag %#x", int(t))
+	}
+}
+
+func entriesString(entries []int) string {
+	s := make([]string, len(entries))
+	for i, e := range entries {
+		s[i] = fmt.Sprint(e)
+	}
+	if len(entries) == 1 {
+		return "entry " + s[0]
+	}
+	return "entries " + strings.Join(s, ", ")
+}
+
+// ValidationError is returned by ACL.Validate when an
+// ACL is invalid. Functions which set ACLs return it as
+// the Err field of an *os.PathError.
+type ValidationError struct {
+	Violations []Violation
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		s[i] = v.String()
+	}
+	return "invalid ACL: " + strings.Join(s, "; ")
+}
+
+// Validate returns nil if a is valid as defined by
+// a.IsValid, and a *ValidationError describing each
+// violation otherwise. Missing entries are reported
+// first, followed by duplicated entries and entries
+// with unknown tags in the order in which they
+// appear in a.
+func (a ACL) Validate() error {
+	var (
+		violations []Violation
+		keys       []Key // in order of first appearance
+		indices    = make(map[Key][]int)
+		named      []int
+		unknown    []Violation
+	)
+	for i, e := range a {
+		switch e.Tag {
+		case TagUserObj, TagGroupObj, TagOther, TagMask:
+		case TagUser, TagGroup:
+			named = append(named, i)
+		default:
+			unknown = append(unknown, Violation{Reason: UnknownTag, Tag: e.Tag, Entries: []int{i}})
+			continue
+		}
+		k := e.Key()
+		if indices[k] == nil {
+			keys = append(keys, k)
+		}
+		indices[k] = append(indices[k], i)
+	}
+
+	for _, t := range []Tag{TagUserObj, TagGroupObj, TagOther} {
+		if len(indices[Key{Tag: t}]) == 0 {
+			violations = append(violations, Violation{Reason: MissingEntry, Tag: t})
+		}
+	}
+	if len(named) > 0 && len(indices[Key{Tag: TagMask}]) == 0 {
+		violations = append(violations, Violation{Reason: MissingEntry, Tag: TagMask, Entries: named})
+	}
+	for _, k := range keys {
+		if len(indices[k]) > 1 {
+			violations = append(violations, Violation{DuplicateEntry, k.Tag, k.Qualifier, indices[k]})
+		}
+	}
+	violations = append(violations, unknown...)
+
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/joshlf/testutil"
+)
+
+func TestValidate(t *testing.T) {
+	for i, test := range []struct {
+		acl  ACL
+		want []Violation
+		msg  string
+	}{
+		{base, nil, ""},
+		{
+			ACL{{TagUser, "1000", 7}, {TagOther, "", 0}, {TagUser, "1000", 4}, {TagGroup, "0", 2}},
+			[]Violation{
+				{Reason: MissingEntry, Tag: TagUserObj},
+				{Reason: MissingEntry, Tag: TagGroupObj},
+				{Reason: MissingEntry, Tag: TagMask, Entries: []int{0, 2, 3}},
+				{Reason: DuplicateEntry, Tag: TagUser, Qualifier: "1000", Entries: []int{0, 2}},
+			},
+			"invalid ACL: missing user_obj entry; missing group_obj entry; " +
+				"missing mask entry required by named entries 0, 2, 3; " +
+				"duplicate qualifier for user 1000 (entries 0, 2)",
+		},
+		{
+			append(ACL{{TagMask, "", 7}, {Tag: tagUndefined}, {TagMask, "", 5}}, base...),
+			[]Violation{
+				{Reason: DuplicateEntry, Tag: TagMask, Entries: []int{0, 2}},
+				{Reason: UnknownTag, Tag: tagUndefined, Entries: []int{1}},
+			},
+			"invalid ACL: duplicate mask entry (entries 0, 2); unknown tag 0x0 (entry 1)",
+		},
+		{
+			append(ACL{{TagOther, "", 7}}, base...),
+			[]Violation{{Reason: DuplicateEntry, Tag: TagOther, Entries: []int{0, 3}}},
+			"invalid ACL: duplicate other entry (entries 0, 3)",
+		},
+	} {
+		err := test.acl.Validate()
+		if test.want == nil {
+			if err != nil {
+				t.Errorf("%v: unexpected error: %v", i, err)
+			}
+			continue
+		}
+		verr, ok := err.(*ValidationError)
+		if !ok {
+			t.Errorf("%v: unexpected error: want *ValidationError; got %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(verr.Violations, test.want) {
+			t.Errorf("%v: unexpected violations: want %v; got %v", i, test.want, verr.Violations)
+		}
+		if verr.Error() != test.msg {
+			t.Errorf("%v: unexpected error message: want %q; got %q", i, test.msg, verr.Error())
+		}
+	}
+}
+
+func TestSetValidationError(t *testing.T) {
+	f := testutil.MustTempFile(t, "", "acl").Name()
+	defer os.Remove(f)
+
+	dir, err := os.Open(filepath.Dir(f))
+	testutil.Must(t, err)
+	defer dir.Close()
+
+	acl := ACL{{TagUserObj, "", 7}, {TagOther, "", 0}}
+	want := &ValidationError{[]Violation{{Reason: MissingEntry, Tag: TagGroupObj}}}
+	for _, test := range []struct {
+		op  string
+		err error
+	}{
+		{"set", Set(f, acl)},
+		{"setdefault", SetDefault(f, acl)},
+		{"set", LSet(f, acl)},
+		{"set", SetAt(dir, filepath.Base(f), acl)},
+		{"setdefault", SetDefaultAt(dir, filepath.Base(f), acl)},
+	} {
+		pe, ok := test.err.(*os.PathError)
+		if !ok || pe.Op != test.op || pe.Path != f || !reflect.DeepEqual(pe.Err, want) {
+			t.Errorf("unexpected error: want %v %v: %v; got %v", test.op, f, want, test.err)
+		}
+	}
+}
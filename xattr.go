@@ -0,0 +1,177 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"syscall"
+)
+
+const (
+	// defined in include/acl_ea.h (see libacl source)
+	aclEAVersion   = 2
+	aclEAHeaderLen = 4
+	aclEAEntrySize = 8
+	aclUndefinedID = math.MaxUint32 // defined in sys/acl.h
+
+	// tag values used in the xattr format, defined in
+	// sys/acl.h; these are independent of the values
+	// of the Tag constants on the current platform
+	xattrTagUserObj  = 0x01
+	xattrTagUser     = 0x02
+	xattrTagGroupObj = 0x04
+	xattrTagGroup    = 0x08
+	xattrTagMask     = 0x10
+	xattrTagOther    = 0x20
+)
+
+var xattrTags = map[Tag]uint16{
+	TagUserObj:  xattrTagUserObj,
+	TagUser:     xattrTagUser,
+	TagGroupObj: xattrTagGroupObj,
+	TagGroup:    xattrTagGroup,
+	TagMask:     xattrTagMask,
+	TagOther:    xattrTagOther,
+}
+
+var tagsFromXattr = map[uint16]Tag{
+	xattrTagUserObj:  TagUserObj,
+	xattrTagUser:     TagUser,
+	xattrTagGroupObj: TagGroupObj,
+	xattrTagGroup:    TagGroup,
+	xattrTagMask:     TagMask,
+	xattrTagOther:    TagOther,
+}
+
+// MarshalXattr encodes a in the binary format used by Linux
+// for the system.posix_acl_access and system.posix_acl_default
+// extended attributes. The entries are written in the order
+// required by the kernel, regardless of their order in a.
+// Only the read, write, and execute permission bits of each
+// entry are encoded.
+//
+// MarshalXattr returns an error matching syscall.EINVAL if
+// an entry has an unknown tag or a TagUser or TagGroup entry
+// has a qualifier which is not a numeric ID. It does not
+// otherwise check that a is valid; see ACL.Validate.
+func MarshalXattr(a ACL) ([]byte, error) {
+	// NOTE(joshlf): I honestly don't know why sorting is required -
+	// all I know is that when the entries are left unsorted, the
+	// setxattrs syscall sometimes returns EINVAL, but when they're
+	// sorted, it never does. I can't find either documentation or
+	// kernel code to explain this behavior. The only evidence is
+	// the source code for libacl's acl_check, which checks the order.
+	a = append(ACL(nil), a...)
+	sort.Stable(sortableACL(a))
+
+	xattr := make([]byte, aclEAHeaderLen+aclEAEntrySize*len(a))
+	binary.LittleEndian.PutUint32(xattr, aclEAVersion)
+	xattrtmp := xattr[aclEAHeaderLen:]
+	for _, ent := range a {
+		tag, ok := xattrTags[ent.Tag]
+		if !ok {
+			return nil, &causeError{fmt.Sprintf("unknown tag %#x", int(ent.Tag)), syscall.EINVAL}
+		}
+		binary.LittleEndian.PutUint16(xattrtmp, tag)
+		binary.LittleEndian.PutUint16(xattrtmp[2:], uint16(ent.perms()))
+		if ent.Tag == TagUser || ent.Tag == TagGroup {
+			qid, ok := ent.Qual().ID()
+			if !ok {
+				return nil, &causeError{fmt.Sprintf("unresolved qualifier %q", ent.Qualifier), syscall.EINVAL}
+			}
+			binary.LittleEndian.PutUint32(xattrtmp[4:], qid)
+		} else {
+			binary.LittleEndian.PutUint32(xattrtmp[4:], aclUndefinedID)
+		}
+		xattrtmp = xattrtmp[aclEAEntrySize:]
+	}
+	return xattr, nil
+}
+
+// UnmarshalXattr decodes an ACL from the binary format used
+// by Linux for the system.posix_acl_access and
+// system.posix_acl_default extended attributes. The entries
+// are returned in the order in which they are encoded, and
+// TagUser and TagGroup entries have numeric qualifiers.
+//
+// UnmarshalXattr returns an error matching ErrMalformedXattr
+// and syscall.EINVAL if xattr is truncated, has a version other than 2, or
+// contains an entry with an unknown tag or with permission
+// bits other than read, write, and execute. Like
+// MarshalXattr, it does not check that the ACL is valid.
+func UnmarshalXattr(xattr []byte) (ACL, error) {
+	if len(xattr) < aclEAHeaderLen {
+		return nil, malformedXattr("truncated header (%d bytes)", len(xattr))
+	}
+	if version := binary.LittleEndian.Uint32(xattr); version != aclEAVersion {
+		return nil, malformedXattr("unsupported version %d", version)
+	}
+	xattr = xattr[aclEAHeaderLen:]
+	if len(xattr)%aclEAEntrySize != 0 {
+		return nil, malformedXattr("truncated entry (%d trailing bytes)", len(xattr)%aclEAEntrySize)
+	}
+
+	acl := make(ACL, 0, len(xattr)/aclEAEntrySize)
+	for i := 0; len(xattr) > 0; i++ {
+		etag := binary.LittleEndian.Uint16(xattr)
+		sperm := binary.LittleEndian.Uint16(xattr[2:])
+		qid := binary.LittleEndian.Uint32(xattr[4:])
+		xattr = xattr[aclEAEntrySize:]
+
+		tag, ok := tagsFromXattr[etag]
+		if !ok {
+			return nil, malformedXattr("entry %d has unknown tag %#x", i, etag)
+		}
+		if sperm&^7 != 0 {
+			return nil, malformedXattr("entry %d has invalid permissions %#o", i, sperm)
+		}
+		ent := Entry{Tag: tag, Perms: os.FileMode(sperm)}
+		if tag == TagUser || tag == TagGroup {
+			ent.Qualifier = fmt.Sprint(qid)
+		}
+		acl = append(acl, ent)
+	}
+	return acl, nil
+}
+
+// malformedXattr returns an error matching ErrMalformedXattr
+// and, like the kernel's rejection of a malformed ACL,
+// syscall.EINVAL.
+func malformedXattr(format string, args ...interface{}) error {
+	return &sysError{ErrMalformedXattr, &causeError{fmt.Sprintf(format, args...), syscall.EINVAL}}
+}
+
+// sort according to the same order as required by libacl's acl_check
+
+func entryPriority(e Entry) int {
+	switch e.Tag {
+	case TagUserObj:
+		return 0
+	case TagUser:
+		return 1
+	case TagGroupObj:
+		return 2
+	case TagGroup:
+		return 3
+	case TagMask:
+		return 4
+	default:
+		return 5
+	}
+}
+
+type sortableACL ACL
+
+func (s sortableACL) Len() int { return len(s) }
+func (s sortableACL) Less(i, j int) bool {
+	return entryPriority(s[i]) < entryPriority(s[j])
+}
+func (s sortableACL) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
@@ -0,0 +1,71 @@
+// Copyright 2020 the authors.
+//
+// Licensed under the Apache License, Version 2.0 (the LICENSE-APACHE file) or
+// the MIT license (the LICENSE-MIT file) at your option. This file may not be
+// copied, modified, or distributed except according to those terms.
+
+package acl
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestXattr(t *testing.T) {
+	acl := ACL{
+		{TagOther, "", 1},
+		{TagGroup, "1000", 6},
+		{TagMask, "", 7},
+		{TagUserObj, "", 7},
+		{TagGroupObj, "", 5},
+		{TagUser, "0", 4},
+	}
+	want := []byte{
+		2, 0, 0, 0, // version
+		0x01, 0, 7, 0, 0xff, 0xff, 0xff, 0xff, // user_obj
+		0x02, 0, 4, 0, 0, 0, 0, 0, // user 0
+		0x04, 0, 5, 0, 0xff, 0xff, 0xff, 0xff, // group_obj
+		0x08, 0, 6, 0, 0xe8, 0x03, 0, 0, // group 1000
+		0x10, 0, 7, 0, 0xff, 0xff, 0xff, 0xff, // mask
+		0x20, 0, 1, 0, 0xff, 0xff, 0xff, 0xff, // other
+	}
+	xattr, err := MarshalXattr(acl)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !bytes.Equal(xattr, want) {
+		t.Errorf("unexpected xattr: want %v; got %v", want, xattr)
+	}
+	got, err := UnmarshalXattr(xattr)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wantACL := ACL{acl[3], acl[5], acl[4], acl[1], acl[2], acl[0]}
+	if !reflect.DeepEqual(got, wantACL) {
+		t.Errorf("unexpected ACL: want %v; got %v", wantACL, got)
+	}
+
+	for i, a := range []ACL{
+		{{Tag: tagUndefined}},
+		{{TagUser, "root", 7}},
+	} {
+		if _, err := MarshalXattr(a); err == nil {
+			t.Errorf("%v: expected error marshaling %v", i, a)
+		}
+	}
+
+	for i, xattr := range [][]byte{
+		nil,
+		{2, 0, 0},
+		{3, 0, 0, 0},
+		{2, 0, 0, 0, 0x01, 0, 7, 0},
+		{2, 0, 0, 0, 0x40, 0, 7, 0, 0xff, 0xff, 0xff, 0xff},
+		{2, 0, 0, 0, 0x01, 0, 8, 0, 0xff, 0xff, 0xff, 0xff},
+	} {
+		_, err := UnmarshalXattr(xattr)
+		if serr, ok := err.(*sysError); !ok || serr.sentinel != ErrMalformedXattr {
+			t.Errorf("%v: unexpected error: want ErrMalformedXattr; got %v", i, err)
+		}
+	}
+}